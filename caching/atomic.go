@@ -0,0 +1,408 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	gc "github.com/patrickmn/go-cache"
+)
+
+var Err_NOT_AN_INTEGER = fmt.Errorf("value is not an integer or out of range")
+
+// compare_and_swap_script sets ARGV[2] when the key holds ARGV[1], ARGV[3] is the ttl in milliseconds
+var compare_and_swap_script = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// IncrementCtx atomically adds delta to the integer stored at key, a missing key counts as 0
+// the expiration of an existing key is kept, new keys get the backend default,
+// counters are stored as plain integers even when the cache compresses or encrypts values,
+// memory caches use go-cache's IncrementInt64 once the counter is stored as an int64
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - delta:int64 => amount to add, negative to decrement
+//
+// returns:
+//   - int64: value after the increment
+//   - error: Err_NOT_AN_INTEGER when the value is not an integer or would overflow
+func (c *cacheImpl) IncrementCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	key = c.key(key)
+	now := time.Now()
+	var res int64
+	var err error
+	switch c.typ {
+	case REDIS_CACHE_TYPE:
+		res, err = c.incrementRedisCache(ctx, key, delta)
+	case MEMORY_CACHE_TYPE:
+		res, err = c.incrementMemcache(key, delta)
+	case TWO_TIER_CACHE_TYPE:
+		res, err = c.incrementRedisCache(ctx, key, delta)
+		c.deleteMem(key)
+	case DISK_CACHE_TYPE:
+		res, err = c.incrementDiskCache(ctx, key, delta)
+	}
+	c.observe(ctx, "INCRBY", now, time.Now(), err, map[string]string{
+		"key":   key,
+		"delta": strconv.FormatInt(delta, 10),
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.publishInvalidation(ctx, key)
+	return res, nil
+}
+
+// SetIfAbsentCtx sets the value only when the key does not exist,
+// memory caches use go-cache's Add
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - value:interface{} => value
+//   - expiration:time.Duration => expiration, 0 keeps the backend default
+//
+// returns:
+//   - bool: true when the value was set
+//   - error: error if any
+func (c *cacheImpl) SetIfAbsentCtx(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	key = c.key(key)
+	value, err := c.encode(key, value)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	var ok bool
+	switch c.typ {
+	case REDIS_CACHE_TYPE:
+		ok, err = c.setIfAbsentRedisCache(ctx, key, value, expiration)
+	case MEMORY_CACHE_TYPE:
+		ok = c.setIfAbsentMemcache(key, value, expiration)
+	case TWO_TIER_CACHE_TYPE:
+		ok, err = c.setIfAbsentRedisCache(ctx, key, value, expiration)
+		if ok {
+			c.deleteMem(key)
+		}
+	case DISK_CACHE_TYPE:
+		ok, err = c.setIfAbsentDiskCache(ctx, key, value, expiration)
+	}
+	c.observe(ctx, "SETNX", now, time.Now(), err, map[string]string{
+		"key": key,
+		"set": strconv.FormatBool(ok),
+	})
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		c.publishInvalidation(ctx, key)
+	}
+	return ok, nil
+}
+
+// CompareAndSwapCtx replaces the value only when the key currently holds old
+// values are compared the way redis stores them, so 5 and "5" are the same value,
+// caches with layers compare the decoded value
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - old:interface{} => expected current value
+//   - value:interface{} => new value
+//   - expiration:time.Duration => expiration of the new value, 0 keeps the backend default
+//
+// returns:
+//   - bool: true when the value was swapped, false when the key is missing or holds another value
+//   - error: error if any
+func (c *cacheImpl) CompareAndSwapCtx(
+	ctx context.Context,
+	key string,
+	old interface{},
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	key = c.key(key)
+	if c.layers != nil {
+		var err error
+		if value, err = c.encode(key, value); err != nil {
+			return false, err
+		}
+		var same bool
+		if old, same, err = c.compareAndSwapLayered(ctx, key, old); err != nil || !same {
+			return false, err
+		}
+	}
+	now := time.Now()
+	var ok bool
+	var err error
+	switch c.typ {
+	case REDIS_CACHE_TYPE:
+		ok, err = c.compareAndSwapRedisCache(ctx, key, old, value, expiration)
+	case MEMORY_CACHE_TYPE:
+		ok = c.compareAndSwapMemcache(key, old, value, expiration)
+	case TWO_TIER_CACHE_TYPE:
+		ok, err = c.compareAndSwapRedisCache(ctx, key, old, value, expiration)
+		if ok {
+			c.deleteMem(key)
+		}
+	case DISK_CACHE_TYPE:
+		ok, err = c.compareAndSwapDiskCache(ctx, key, old, value, expiration)
+	}
+	c.observe(ctx, "CAS", now, time.Now(), err, map[string]string{
+		"key":     key,
+		"swapped": strconv.FormatBool(ok),
+	})
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		c.publishInvalidation(ctx, key)
+	}
+	return ok, nil
+}
+
+// toInt64 parses a stored value as an integer
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// addInt64 adds delta to n and reports whether the result overflowed
+func addInt64(n int64, delta int64) (int64, bool) {
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, false
+	}
+	return n + delta, true
+}
+
+// sameValue compares two values by their redis encoding, falling back to deep equality
+// for values redis can't encode
+func sameValue(a interface{}, b interface{}) bool {
+	encodedA, errA := encodeDiskValue(a)
+	encodedB, errB := encodeDiskValue(b)
+	if errA == nil && errB == nil {
+		return bytes.Equal(encodedA, encodedB)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ===============================================================================	Redis	Cache	=========================================================================
+func (c *cacheImpl) incrementRedisCache(ctx context.Context, key string, delta int64) (int64, error) {
+	if err := c.available(); err != nil {
+		return 0, err
+	}
+	res, err := c.redis.IncrBy(ctx, key, delta).Result()
+	if err != nil && (strings.Contains(err.Error(), "not an integer") ||
+		strings.Contains(err.Error(), "overflow")) {
+		return 0, Err_NOT_AN_INTEGER
+	}
+	return res, err
+}
+
+func (c *cacheImpl) setIfAbsentRedisCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	if err := c.available(); err != nil {
+		return false, err
+	}
+	return c.redis.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (c *cacheImpl) compareAndSwapRedisCache(
+	ctx context.Context,
+	key string,
+	old interface{},
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	if err := c.available(); err != nil {
+		return false, err
+	}
+	res, err := compare_and_swap_script.Run(
+		ctx,
+		c.redis,
+		[]string{key},
+		old,
+		value,
+		expiration.Milliseconds(),
+	).Int()
+	return res == 1, err
+}
+
+// ===============================================================================	Memory	Cache	=========================================================================
+func (c *cacheImpl) incrementMemcache(key string, delta int64) (int64, error) {
+	return c.mem.Increment(key, delta)
+}
+
+func (c *cacheImpl) setIfAbsentMemcache(
+	key string,
+	value interface{},
+	expiration time.Duration,
+) bool {
+	return c.mem.Add(key, value, expiration)
+}
+
+func (c *cacheImpl) compareAndSwapMemcache(
+	key string,
+	old interface{},
+	value interface{},
+	expiration time.Duration,
+) bool {
+	swapped := false
+	c.mem.Update(key, expiration, func(current interface{}, found bool) (interface{}, bool) {
+		swapped = found && sameValue(current, old)
+		return value, swapped
+	})
+	return swapped
+}
+
+// ===============================================================================	Disk	Cache	=========================================================================
+func (c *cacheImpl) incrementDiskCache(ctx context.Context, key string, delta int64) (int64, error) {
+	tx, err := c.disk.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var value []byte
+	var expiresAt int64
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT value, expires_at FROM cache_entries WHERE key = ?",
+		key,
+	).Scan(&value, &expiresAt)
+	var n int64
+	switch {
+	case err == sql.ErrNoRows || (err == nil && expiresAt > 0 && expiresAt <= time.Now().UnixNano()):
+		expiresAt = c.disk.expiresAt(gc.DefaultExpiration)
+	case err != nil:
+		return 0, err
+	default:
+		var ok bool
+		if n, ok = toInt64(value); !ok {
+			return 0, Err_NOT_AN_INTEGER
+		}
+	}
+	n, ok := addInt64(n, delta)
+	if !ok {
+		return 0, Err_NOT_AN_INTEGER
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		disk_upsert,
+		key,
+		strconv.AppendInt(nil, n, 10),
+		expiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (c *cacheImpl) setIfAbsentDiskCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	byts, err := encodeDiskValue(value)
+	if err != nil {
+		return false, err
+	}
+	// an expired entry that was not compacted yet counts as absent
+	res, err := c.disk.db.ExecContext(
+		ctx,
+		`INSERT INTO cache_entries (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at
+		WHERE cache_entries.expires_at > 0 AND cache_entries.expires_at <= ?`,
+		key,
+		byts,
+		c.disk.expiresAt(expiration),
+		time.Now().UnixNano(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (c *cacheImpl) compareAndSwapDiskCache(
+	ctx context.Context,
+	key string,
+	old interface{},
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	expected, err := encodeDiskValue(old)
+	if err != nil {
+		return false, err
+	}
+	byts, err := encodeDiskValue(value)
+	if err != nil {
+		return false, err
+	}
+	res, err := c.disk.db.ExecContext(
+		ctx,
+		`UPDATE cache_entries SET value = ?, expires_at = ?
+		WHERE key = ? AND value = ? AND (expires_at = 0 OR expires_at > ?)`,
+		byts,
+		c.disk.expiresAt(expiration),
+		key,
+		expected,
+		time.Now().UnixNano(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,112 @@
+package caching
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAtomicOperations(t *testing.T, c Cache, prefix string) {
+	ctx := context.Background()
+	counter := prefix + "counter"
+	assert.Nil(t, c.DeleteManyCtx(ctx, []string{counter, prefix + "marker", prefix + "cas", prefix + "text"}))
+
+	n, err := c.IncrementCtx(ctx, counter, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = c.IncrementCtx(ctx, counter, -5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-3), n)
+
+	// concurrent increments are not lost
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.IncrementCtx(ctx, counter, 1)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	n, err = c.IncrementCtx(ctx, counter, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(47), n)
+
+	assert.Nil(t, c.SetCtx(ctx, prefix+"text", "hello"))
+	_, err = c.IncrementCtx(ctx, prefix+"text", 1)
+	assert.Equal(t, Err_NOT_AN_INTEGER, err)
+
+	ok, err := c.SetIfAbsentCtx(ctx, prefix+"marker", "first", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetIfAbsentCtx(ctx, prefix+"marker", "second", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	v, err := c.GetCtx(ctx, prefix+"marker")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", v)
+
+	ok, err = c.CompareAndSwapCtx(ctx, prefix+"cas", "a", "b", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, c.SetCtx(ctx, prefix+"cas", 1))
+	ok, err = c.CompareAndSwapCtx(ctx, prefix+"cas", 2, 3, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwapCtx(ctx, prefix+"cas", "1", 2, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	v, err = c.GetCtx(ctx, prefix+"cas")
+	assert.Nil(t, err)
+	assert.Contains(t, []interface{}{2, "2"}, v)
+}
+
+func TestIncrementKeepsExpiration(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.SetWithExpirationCtx(ctx, "counter", 1, 10*time.Millisecond))
+	n, err := c.IncrementCtx(ctx, "counter", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	time.Sleep(20 * time.Millisecond)
+	_, err = c.GetCtx(ctx, "counter")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+}
+
+func TestGoCacheStoreIncrement(t *testing.T) {
+	s := newGoCacheStore(time.Minute, time.Minute)
+	n, err := s.Increment("missing", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// other integer forms are rewritten as an int64 so IncrementInt64 handles the next call
+	s.Set("counter", "5", 20*time.Millisecond)
+	n, err = s.Increment("counter", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), n)
+	val, _ := s.Get("counter")
+	assert.Equal(t, int64(6), val)
+	n, err = s.Increment("counter", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), n)
+	time.Sleep(30 * time.Millisecond)
+	_, found := s.Get("counter")
+	assert.False(t, found)
+
+	assert.True(t, s.Add("added", "first", 0))
+	assert.False(t, s.Add("added", "second", 0))
+	val, _ = s.Get("added")
+	assert.Equal(t, "first", val)
+}
+
+func TestIncrementOverflow(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.SetCtx(ctx, "counter", int64(1<<62)))
+	_, err := c.IncrementCtx(ctx, "counter", 1<<62)
+	assert.Equal(t, Err_NOT_AN_INTEGER, err)
+}
@@ -0,0 +1,405 @@
+package caching
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	gc "github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+)
+
+// EvictionPolicy selects the entries a bounded memory cache drops once it is full
+type EvictionPolicy string
+
+const (
+	// LRU_EVICTION_POLICY evicts the least recently used entry
+	LRU_EVICTION_POLICY EvictionPolicy = "LRU"
+	// LFU_EVICTION_POLICY evicts the least frequently used entry
+	LFU_EVICTION_POLICY EvictionPolicy = "LFU"
+	// TINY_LFU_EVICTION_POLICY admits entries based on their recent frequency (W-TinyLFU),
+	// it resists scans and one-off keys better than LRU
+	TINY_LFU_EVICTION_POLICY EvictionPolicy = "W-TinyLFU"
+)
+
+// EvictionReason tells why an entry left a bounded memory cache
+type EvictionReason string
+
+const (
+	EVICTION_REASON_CAPACITY EvictionReason = "capacity"
+	EVICTION_REASON_EXPIRED  EvictionReason = "expired"
+)
+
+var Err_INVALID_MEMORY_OPTIONS = fmt.Errorf("invalid memory cache options")
+
+// BoundedMemoryOptions configures a bounded in-memory cache
+// params:
+//   - MaxEntries: maximum number of entries, 0 means no entry limit
+//   - MaxBytes: maximum estimated size of the entries, 0 means no byte budget
+//   - Sizer: estimates the size of an entry, defaults to the length of the key
+//     plus the length of the value ([]byte, string) or of its JSON encoding
+//   - Policy: eviction policy, defaults to LRU_EVICTION_POLICY
+//   - Expiration: default expiration of the entries, 0 means no expiration
+//   - CleanupInterval: how often expired entries are purged, 0 purges them lazily on access
+//   - OnEvict: optional callback invoked when an entry is evicted or expires,
+//     explicit deletes do not trigger it, keys of named caches include their namespace
+type BoundedMemoryOptions struct {
+	MaxEntries      int
+	MaxBytes        int64
+	Sizer           func(key string, value interface{}) int64
+	Policy          EvictionPolicy
+	Expiration      time.Duration
+	CleanupInterval time.Duration
+	OnEvict         func(key string, value interface{}, reason EvictionReason)
+}
+
+// InitBoundedMemoryCache initializes cache with in-memory type bounded by an entry count
+// and/or a byte budget, the policy picks the entries dropped once the bound is reached
+// params:
+//   - opts: options, MaxEntries or MaxBytes is required
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitBoundedMemoryCache(opts *BoundedMemoryOptions) (Cache, error) {
+	if opts == nil || (opts.MaxEntries <= 0 && opts.MaxBytes <= 0) {
+		return nil, Err_INVALID_MEMORY_OPTIONS
+	}
+	metrics := metricsFor("", MEMORY_CACHE_TYPE)
+	c := &cacheImpl{
+		typ:       MEMORY_CACHE_TYPE,
+		mem:       newBoundedStore(opts),
+		lgr:       zap.NewNop(),
+		flights:   newFlightGroup(),
+		tags:      newTagIndex(),
+		locks:     newMemoryLockBackend(),
+		metrics:   metrics,
+		evictions: newEvictionTracker(metrics),
+	}
+	c.watchEvictions()
+	return c, nil
+}
+
+type boundedEntry struct {
+	key       string
+	value     interface{}
+	expiresAt int64
+	size      int64
+	elem      *list.Element
+	freq      uint64
+	segment   int
+}
+
+func (e *boundedEntry) expired(now int64) bool {
+	return e.expiresAt > 0 && now > e.expiresAt
+}
+
+type evictedEntry struct {
+	key    string
+	value  interface{}
+	reason EvictionReason
+}
+
+type boundedStore struct {
+	mtx        sync.Mutex
+	items      map[string]*boundedEntry
+	policy     evictionPolicy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	sizer      func(key string, value interface{}) int64
+	expiration time.Duration
+	onEvict    func(key string, value interface{}, reason EvictionReason)
+	onEvicted  func(key string, value interface{})
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func newBoundedStore(opts *BoundedMemoryOptions) *boundedStore {
+	s := &boundedStore{
+		items:      map[string]*boundedEntry{},
+		maxEntries: opts.MaxEntries,
+		maxBytes:   opts.MaxBytes,
+		sizer:      opts.Sizer,
+		expiration: opts.Expiration,
+		onEvict:    opts.OnEvict,
+		stop:       make(chan struct{}),
+	}
+	if s.sizer == nil {
+		s.sizer = estimateSize
+	}
+	// the policy works in entries when there is an entry limit and in bytes otherwise
+	capacity := int64(opts.MaxEntries)
+	weight := func(e *boundedEntry) int64 { return 1 }
+	if opts.MaxEntries <= 0 {
+		capacity = opts.MaxBytes
+		weight = func(e *boundedEntry) int64 { return e.size }
+	}
+	s.policy = newEvictionPolicy(opts.Policy, capacity, weight)
+	if opts.CleanupInterval > 0 {
+		go s.janitor(opts.CleanupInterval)
+	}
+	return s
+}
+
+func (s *boundedStore) Get(key string) (interface{}, bool) {
+	s.mtx.Lock()
+	e, ok := s.items[key]
+	if !ok {
+		s.mtx.Unlock()
+		return nil, false
+	}
+	if e.expired(time.Now().UnixNano()) {
+		s.unlink(e)
+		s.mtx.Unlock()
+		s.notify([]evictedEntry{{e.key, e.value, EVICTION_REASON_EXPIRED}})
+		return nil, false
+	}
+	s.policy.touch(e)
+	s.mtx.Unlock()
+	return e.value, true
+}
+
+func (s *boundedStore) Set(key string, value interface{}, ttl time.Duration) {
+	size := s.sizer(key, value)
+	s.mtx.Lock()
+	evicted := s.store(key, value, s.deadline(ttl), size)
+	s.mtx.Unlock()
+	s.notify(evicted)
+}
+
+func (s *boundedStore) Update(key string, ttl time.Duration, fn updateFn) {
+	evicted := []evictedEntry{}
+	s.mtx.Lock()
+	e, found := s.items[key]
+	if found && e.expired(time.Now().UnixNano()) {
+		s.unlink(e)
+		evicted = append(evicted, evictedEntry{e.key, e.value, EVICTION_REASON_EXPIRED})
+		found = false
+	}
+	var current interface{}
+	if found {
+		current = e.value
+	}
+	value, ok := fn(current, found)
+	if ok {
+		expiresAt := s.deadline(ttl)
+		if ttl == keep_ttl && found {
+			expiresAt = e.expiresAt
+		}
+		evicted = append(evicted, s.store(key, value, expiresAt, s.sizer(key, value))...)
+	}
+	s.mtx.Unlock()
+	s.notify(evicted)
+}
+
+func (s *boundedStore) Add(key string, value interface{}, ttl time.Duration) bool {
+	added := false
+	s.Update(key, ttl, func(current interface{}, found bool) (interface{}, bool) {
+		added = !found
+		return value, added
+	})
+	return added
+}
+
+func (s *boundedStore) Increment(key string, delta int64) (int64, error) {
+	var res int64
+	err := Err_NOT_AN_INTEGER
+	s.Update(key, keep_ttl, func(current interface{}, found bool) (interface{}, bool) {
+		var n int64
+		if found {
+			var ok bool
+			if n, ok = toInt64(current); !ok {
+				return nil, false
+			}
+		}
+		n, ok := addInt64(n, delta)
+		if !ok {
+			return nil, false
+		}
+		res, err = n, nil
+		return n, true
+	})
+	return res, err
+}
+
+// deadline converts a ttl to an expiration timestamp, 0 means no expiration
+func (s *boundedStore) deadline(ttl time.Duration) int64 {
+	if ttl == gc.DefaultExpiration || ttl == keep_ttl {
+		ttl = s.expiration
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+// store inserts or replaces an entry and returns the entries evicted to make room
+// for it, the lock must be held
+func (s *boundedStore) store(
+	key string,
+	value interface{},
+	expiresAt int64,
+	size int64,
+) []evictedEntry {
+	e, exists := s.items[key]
+	if s.maxBytes > 0 && size > s.maxBytes {
+		// the entry alone is over budget, it is dropped along with any older value
+		if exists {
+			s.unlink(e)
+		}
+		return []evictedEntry{{key, value, EVICTION_REASON_CAPACITY}}
+	}
+	if exists && (s.maxEntries > 0 || size == e.size) {
+		s.bytes += size - e.size
+		e.value, e.expiresAt, e.size = value, expiresAt, size
+		s.policy.touch(e)
+	} else if exists {
+		// the policy weight is the size, it must not change while the entry is tracked
+		s.policy.remove(e)
+		s.bytes += size - e.size
+		e.value, e.expiresAt, e.size = value, expiresAt, size
+		s.policy.add(e)
+	} else {
+		e = &boundedEntry{key: key, value: value, expiresAt: expiresAt, size: size}
+		s.items[key] = e
+		s.bytes += size
+		s.policy.add(e)
+	}
+	evicted := []evictedEntry{}
+	for s.overBudget() {
+		v := s.policy.victim()
+		if v == nil {
+			break
+		}
+		s.unlink(v)
+		evicted = append(evicted, evictedEntry{v.key, v.value, EVICTION_REASON_CAPACITY})
+	}
+	return evicted
+}
+
+func (s *boundedStore) Delete(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.unlink(e)
+	}
+}
+
+func (s *boundedStore) Keys() []string {
+	now := time.Now().UnixNano()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	keys := make([]string, 0, len(s.items))
+	for key, e := range s.items {
+		if !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (s *boundedStore) Items() map[string]gc.Item {
+	now := time.Now().UnixNano()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	items := make(map[string]gc.Item, len(s.items))
+	for key, e := range s.items {
+		if !e.expired(now) {
+			items[key] = gc.Item{Object: e.value, Expiration: e.expiresAt}
+		}
+	}
+	return items
+}
+
+func (s *boundedStore) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.items)
+}
+
+func (s *boundedStore) OnEvicted(fn func(key string, value interface{})) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.onEvicted = fn
+}
+
+func (s *boundedStore) close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *boundedStore) overBudget() bool {
+	return (s.maxEntries > 0 && len(s.items) > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+// unlink removes the entry from the map and the policy, the lock must be held
+func (s *boundedStore) unlink(e *boundedEntry) {
+	delete(s.items, e.key)
+	s.bytes -= e.size
+	s.policy.remove(e)
+}
+
+// notify runs the eviction callbacks, the lock must not be held
+func (s *boundedStore) notify(evicted []evictedEntry) {
+	if len(evicted) == 0 {
+		return
+	}
+	s.mtx.Lock()
+	onEvicted := s.onEvicted
+	s.mtx.Unlock()
+	for _, e := range evicted {
+		if onEvicted != nil {
+			onEvicted(e.key, e.value)
+		}
+		if s.onEvict != nil {
+			s.onEvict(e.key, e.value, e.reason)
+		}
+	}
+}
+
+func (s *boundedStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.deleteExpired()
+		}
+	}
+}
+
+func (s *boundedStore) deleteExpired() {
+	now := time.Now().UnixNano()
+	evicted := []evictedEntry{}
+	s.mtx.Lock()
+	for _, e := range s.items {
+		if e.expired(now) {
+			s.unlink(e)
+			evicted = append(evicted, evictedEntry{e.key, e.value, EVICTION_REASON_EXPIRED})
+		}
+	}
+	s.mtx.Unlock()
+	s.notify(evicted)
+}
+
+// estimateSize is the default sizer of bounded stores
+func estimateSize(key string, value interface{}) int64 {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(key) + len(v))
+	case string:
+		return int64(len(key) + len(v))
+	}
+	byts, err := json.Marshal(value)
+	if err != nil {
+		return int64(len(key))
+	}
+	return int64(len(key) + len(byts))
+}
@@ -0,0 +1,165 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type evictionRecorder struct {
+	mtx     sync.Mutex
+	keys    []string
+	reasons []EvictionReason
+}
+
+func (r *evictionRecorder) onEvict(key string, value interface{}, reason EvictionReason) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.keys = append(r.keys, key)
+	r.reasons = append(r.reasons, reason)
+}
+
+func TestBoundedInvalidOptions(t *testing.T) {
+	_, err := InitBoundedMemoryCache(nil)
+	assert.Equal(t, Err_INVALID_MEMORY_OPTIONS, err)
+	_, err = InitBoundedMemoryCache(&BoundedMemoryOptions{Policy: LRU_EVICTION_POLICY})
+	assert.Equal(t, Err_INVALID_MEMORY_OPTIONS, err)
+}
+
+func TestBoundedLRU(t *testing.T) {
+	ctx := context.Background()
+	rec := &evictionRecorder{}
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+		MaxEntries: 2,
+		OnEvict:    rec.onEvict,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetCtx(ctx, "a", 1))
+	assert.Nil(t, c.SetCtx(ctx, "b", 2))
+	_, err = c.GetCtx(ctx, "a")
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetCtx(ctx, "c", 3))
+
+	_, err = c.GetCtx(ctx, "b")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	keys, err := c.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"a", "c"}, keys)
+	assert.Equal(t, []string{"b"}, rec.keys)
+	assert.Equal(t, []EvictionReason{EVICTION_REASON_CAPACITY}, rec.reasons)
+}
+
+func TestBoundedLFU(t *testing.T) {
+	ctx := context.Background()
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+		MaxEntries: 2,
+		Policy:     LFU_EVICTION_POLICY,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetCtx(ctx, "a", 1))
+	assert.Nil(t, c.SetCtx(ctx, "b", 2))
+	for i := 0; i < 3; i++ {
+		_, err = c.GetCtx(ctx, "a")
+		assert.Nil(t, err)
+	}
+	_, err = c.GetCtx(ctx, "b")
+	assert.Nil(t, err)
+	// b is used less often than a, the new entry replaces it
+	assert.Nil(t, c.SetCtx(ctx, "c", 3))
+	_, err = c.GetCtx(ctx, "b")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	_, err = c.GetCtx(ctx, "a")
+	assert.Nil(t, err)
+	_, err = c.GetCtx(ctx, "c")
+	assert.Nil(t, err)
+}
+
+func TestBoundedTinyLFUResistsScans(t *testing.T) {
+	ctx := context.Background()
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+		MaxEntries: 100,
+		Policy:     TINY_LFU_EVICTION_POLICY,
+	})
+	assert.Nil(t, err)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, c.SetCtx(ctx, fmt.Sprintf("hot_%d", i), i))
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			_, err = c.GetCtx(ctx, fmt.Sprintf("hot_%d", i))
+			assert.Nil(t, err)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, c.SetCtx(ctx, fmt.Sprintf("scan_%d", i), i))
+	}
+	keys, err := c.KeysCtx(ctx, "hot_*")
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, len(keys), 45)
+	all, err := c.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, len(all), 100)
+}
+
+func TestBoundedMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	rec := &evictionRecorder{}
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+		MaxBytes: 10,
+		OnEvict:  rec.onEvict,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetCtx(ctx, "a", "1234"))
+	assert.Nil(t, c.SetCtx(ctx, "b", "1234"))
+	assert.Nil(t, c.SetCtx(ctx, "c", "1234"))
+	_, err = c.GetCtx(ctx, "a")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	// larger than the whole budget, never stored
+	assert.Nil(t, c.SetCtx(ctx, "big", "0123456789"))
+	_, err = c.GetCtx(ctx, "big")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	assert.Equal(t, []string{"a", "big"}, rec.keys)
+}
+
+func TestBoundedExpiration(t *testing.T) {
+	ctx := context.Background()
+	rec := &evictionRecorder{}
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+		MaxEntries: 10,
+		OnEvict:    rec.onEvict,
+	})
+	assert.Nil(t, err)
+	c = c.WithName("bounded_expiration")
+	assert.Nil(t, c.SetWithExpirationCtx(ctx, "short", "v", time.Millisecond))
+	assert.Nil(t, c.SetCtx(ctx, "deleted", "v"))
+	assert.Nil(t, c.DeleteCtx(ctx, "deleted"))
+	time.Sleep(5 * time.Millisecond)
+	_, err = c.GetCtx(ctx, "short")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	assert.Equal(t, []string{"bounded_expiration:short"}, rec.keys)
+	assert.Equal(t, []EvictionReason{EVICTION_REASON_EXPIRED}, rec.reasons)
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+	assert.Nil(t, c.Close())
+}
+
+func TestBoundedJanitor(t *testing.T) {
+	rec := &evictionRecorder{}
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+		MaxEntries:      10,
+		Expiration:      time.Millisecond,
+		CleanupInterval: 5 * time.Millisecond,
+		OnEvict:         rec.onEvict,
+	})
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Nil(t, c.Set("key", "v"))
+	assert.Eventually(t, func() bool {
+		rec.mtx.Lock()
+		defer rec.mtx.Unlock()
+		return len(rec.keys) == 1
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,362 @@
+package caching
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	gc "github.com/patrickmn/go-cache"
+)
+
+// BulkResult is the outcome of GetManyCtx
+// Found holds the values of the keys that exist, Missing the keys that do not
+type BulkResult struct {
+	Found   map[string]interface{}
+	Missing []string
+}
+
+// GetManyCtx returns the values for the given keys in a single round trip
+// params:
+//   - ctx: context
+//   - keys:[]string => keys
+//
+// returns:
+//   - *BulkResult: found values and missing keys
+//   - error: error if any
+func (c *cacheImpl) GetManyCtx(ctx context.Context, keys []string) (*BulkResult, error) {
+	keys = c.keysOf(keys)
+	now := time.Now()
+	res := &BulkResult{
+		Found:   make(map[string]interface{}, len(keys)),
+		Missing: []string{},
+	}
+	var err error
+	if len(keys) > 0 {
+		switch c.typ {
+		case REDIS_CACHE_TYPE:
+			err = c.fetchManyFromRedisCache(ctx, keys, res)
+		case MEMORY_CACHE_TYPE:
+			err = c.fetchManyFromMemcache(ctx, keys, res)
+		case TWO_TIER_CACHE_TYPE:
+			err = c.fetchManyFromTwoTierCache(ctx, keys, res)
+		case DISK_CACHE_TYPE:
+			err = c.fetchManyFromDiskCache(ctx, keys, res)
+		}
+	}
+	c.metrics.hit(len(res.Found))
+	c.metrics.miss(len(res.Missing))
+	c.observe(ctx, "MGET", now, time.Now(), err, map[string]string{
+		"keys":    strings.Join(keys, ","),
+		"count":   strconv.Itoa(len(keys)),
+		"missing": strconv.Itoa(len(res.Missing)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.prefix != "" || c.layers != nil {
+		found := make(map[string]interface{}, len(res.Found))
+		for k, v := range res.Found {
+			if v, err = c.decode(k, v); err != nil {
+				return nil, err
+			}
+			found[c.unkey(k)] = v
+		}
+		res.Found = found
+		for i, k := range res.Missing {
+			res.Missing[i] = c.unkey(k)
+		}
+	}
+	return res, nil
+}
+
+// SetManyCtx sets the given values in a single round trip
+// params:
+//   - ctx: context
+//   - items:map[string]interface{} => values by key
+//   - expiration:time.Duration => expiration, 0 keeps the backend default
+//
+// returns:
+//   - error: error if any
+func (c *cacheImpl) SetManyCtx(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	if c.prefix != "" || c.layers != nil {
+		stored := make(map[string]interface{}, len(items))
+		for k, v := range items {
+			k = c.key(k)
+			v, err := c.encode(k, v)
+			if err != nil {
+				return err
+			}
+			stored[k] = v
+		}
+		items = stored
+	}
+	now := time.Now()
+	var err error
+	if len(items) > 0 {
+		switch c.typ {
+		case REDIS_CACHE_TYPE:
+			err = c.setManyRedisCache(ctx, items, expiration)
+		case MEMORY_CACHE_TYPE:
+			err = c.setManyMemcache(ctx, items, expiration)
+		case TWO_TIER_CACHE_TYPE:
+			err = c.setManyTwoTierCache(ctx, items, expiration)
+		case DISK_CACHE_TYPE:
+			err = c.setManyDiskCache(ctx, items, expiration)
+		}
+	}
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	c.observe(ctx, "MSET", now, time.Now(), err, map[string]string{
+		"keys":       strings.Join(keys, ","),
+		"count":      strconv.Itoa(len(keys)),
+		"expiration": expiration.String(),
+	})
+	if err != nil {
+		return err
+	}
+	c.publishInvalidation(ctx, keys...)
+	return nil
+}
+
+// DeleteManyCtx deletes the given keys in a single round trip
+// params:
+//   - ctx: context
+//   - keys:[]string => keys
+//
+// returns:
+//   - error: error if any
+func (c *cacheImpl) DeleteManyCtx(ctx context.Context, keys []string) error {
+	keys = c.keysOf(keys)
+	now := time.Now()
+	var err error
+	if len(keys) > 0 {
+		switch c.typ {
+		case REDIS_CACHE_TYPE:
+			err = c.deleteManyFromRedisCache(ctx, keys)
+		case MEMORY_CACHE_TYPE:
+			err = c.deleteManyFromMemcache(ctx, keys)
+		case TWO_TIER_CACHE_TYPE:
+			err = c.deleteManyFromTwoTierCache(ctx, keys)
+		case DISK_CACHE_TYPE:
+			err = c.deleteManyFromDiskCache(ctx, keys)
+		}
+	}
+	c.observe(ctx, "MDEL", now, time.Now(), err, map[string]string{
+		"keys":  strings.Join(keys, ","),
+		"count": strconv.Itoa(len(keys)),
+	})
+	if err != nil {
+		return err
+	}
+	c.publishInvalidation(ctx, keys...)
+	return nil
+}
+
+// ===============================================================================	Redis	Cache	=========================================================================
+func (c *cacheImpl) fetchManyFromRedisCache(
+	ctx context.Context,
+	keys []string,
+	res *BulkResult,
+) error {
+	if err := c.available(); err != nil {
+		return err
+	}
+	vals, err := c.mgetRedis(ctx, keys)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if vals[i] == nil {
+			res.Missing = append(res.Missing, key)
+			continue
+		}
+		res.Found[key] = vals[i]
+	}
+	return nil
+}
+
+func (c *cacheImpl) setManyRedisCache(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	if err := c.available(); err != nil {
+		return err
+	}
+	_, err := c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for k, v := range items {
+			pipe.Set(ctx, k, v, expiration)
+		}
+		return nil
+	})
+	return err
+}
+
+func (c *cacheImpl) deleteManyFromRedisCache(
+	ctx context.Context,
+	keys []string,
+) error {
+	if err := c.available(); err != nil {
+		return err
+	}
+	if !c.isCluster() {
+		return c.redis.Del(ctx, keys...).Err()
+	}
+	// keys rarely share a hash slot, a multi key DEL would fail with CROSSSLOT
+	_, err := c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// mgetRedis returns the values of the keys in order, nil for the missing ones
+func (c *cacheImpl) mgetRedis(ctx context.Context, keys []string) ([]interface{}, error) {
+	if !c.isCluster() {
+		return c.redis.MGet(ctx, keys...).Result()
+	}
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	vals := make([]interface{}, len(keys))
+	for i := range cmds {
+		v, err := cmds[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// ===============================================================================	Memory	Cache	=========================================================================
+func (c *cacheImpl) fetchManyFromMemcache(
+	ctx context.Context,
+	keys []string,
+	res *BulkResult,
+) error {
+	for _, key := range keys {
+		v, ok := c.mem.Get(key)
+		if !ok {
+			res.Missing = append(res.Missing, key)
+			continue
+		}
+		res.Found[key] = v
+	}
+	return nil
+}
+
+func (c *cacheImpl) setManyMemcache(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	if expiration <= 0 {
+		expiration = gc.DefaultExpiration
+	}
+	for k, v := range items {
+		c.mem.Set(k, v, expiration)
+	}
+	return nil
+}
+
+func (c *cacheImpl) deleteManyFromMemcache(
+	ctx context.Context,
+	keys []string,
+) error {
+	for _, key := range keys {
+		c.deleteMem(key)
+	}
+	return nil
+}
+
+// ===============================================================================	Two	Tier	Cache	=========================================================================
+func (c *cacheImpl) fetchManyFromTwoTierCache(
+	ctx context.Context,
+	keys []string,
+	res *BulkResult,
+) error {
+	l1 := &BulkResult{
+		Found:   res.Found,
+		Missing: []string{},
+	}
+	c.fetchManyFromMemcache(ctx, keys, l1)
+	if len(l1.Missing) == 0 {
+		return nil
+	}
+	l2 := &BulkResult{
+		Found:   make(map[string]interface{}, len(l1.Missing)),
+		Missing: []string{},
+	}
+	if err := c.fetchManyFromRedisCache(ctx, l1.Missing, l2); err != nil {
+		return err
+	}
+	// L1 copies must not outlive the redis entries
+	pipe := c.redis.Pipeline()
+	pttls := make(map[string]*redis.DurationCmd, len(l2.Found))
+	for k := range l2.Found {
+		pttls[k] = pipe.PTTL(ctx, k)
+	}
+	if len(pttls) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	for k, v := range l2.Found {
+		if s, ok := v.(string); ok {
+			c.fillL1(k, s, pttls[k].Val())
+		}
+		res.Found[k] = v
+	}
+	res.Missing = append(res.Missing, l2.Missing...)
+	return nil
+}
+
+func (c *cacheImpl) setManyTwoTierCache(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	if err := c.setManyRedisCache(ctx, items, expiration); err != nil {
+		for k := range items {
+			c.deleteMem(k)
+		}
+		return err
+	}
+	ttl := c.l1TTL
+	if expiration > 0 && expiration < ttl {
+		ttl = expiration
+	}
+	for k, v := range items {
+		c.setL1(k, v, ttl)
+	}
+	return nil
+}
+
+func (c *cacheImpl) deleteManyFromTwoTierCache(
+	ctx context.Context,
+	keys []string,
+) error {
+	c.deleteManyFromMemcache(ctx, keys)
+	return c.deleteManyFromRedisCache(ctx, keys)
+}
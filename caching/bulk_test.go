@@ -0,0 +1,36 @@
+package caching
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBulkOperations(t *testing.T, c Cache, prefix string) {
+	ctx := context.Background()
+	err := c.SetManyCtx(ctx, map[string]interface{}{
+		prefix + "a": "1",
+		prefix + "b": "2",
+	}, time.Minute)
+	assert.Nil(t, err)
+	res, err := c.GetManyCtx(ctx, []string{prefix + "a", prefix + "b", prefix + "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{prefix + "a": "1", prefix + "b": "2"}, res.Found)
+	assert.Equal(t, []string{prefix + "c"}, res.Missing)
+	err = c.DeleteManyCtx(ctx, []string{prefix + "a", prefix + "b"})
+	assert.Nil(t, err)
+	res, err = c.GetManyCtx(ctx, []string{prefix + "a", prefix + "b"})
+	assert.Nil(t, err)
+	assert.Empty(t, res.Found)
+	assert.ElementsMatch(t, []string{prefix + "a", prefix + "b"}, res.Missing)
+}
+
+func TestBulkEmpty(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute)
+	res, err := c.GetManyCtx(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Empty(t, res.Found)
+	assert.Empty(t, res.Missing)
+}
@@ -3,18 +3,21 @@ package caching
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
 	tracer "github.com/BetaLixT/appInsightsTrace"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	gc "github.com/patrickmn/go-cache"
 	"go.uber.org/zap"
 )
 
 const (
-	MEMORY_CACHE_TYPE = "Memory"
-	REDIS_CACHE_TYPE  = "Redis"
+	MEMORY_CACHE_TYPE   = "Memory"
+	REDIS_CACHE_TYPE    = "Redis"
+	TWO_TIER_CACHE_TYPE = "TwoTier"
+	DISK_CACHE_TYPE     = "Disk"
 )
 
 var Err_KEY_NOT_FOUND = fmt.Errorf("key not found")
@@ -36,25 +39,103 @@ type Cache interface {
 	DeleteCtx(ctx context.Context, key string) error
 	Keys(pattern string) ([]string, error)
 	KeysCtx(ctx context.Context, pattern string) ([]string, error)
+	Stats() CacheStats
 	WithLogger(l *zap.Logger) Cache
 	WithTracer(t *tracer.AppInsightsCore) Cache
+	WithHook(h Hook) Cache
 	WithName(name string) Cache
+	WithVersion(version int) Cache
+	WithCompression(opts *CompressionOptions) Cache
+	WithEncryption(k *Keyring) Cache
+	WithInvalidationBus(bus InvalidationBus) Cache
+	WithHealthCheck(opts *HealthCheckOptions) Cache
+	Healthy() bool
+	Close() error
+	GetOrLoad(
+		ctx context.Context,
+		key string,
+		ttl time.Duration,
+		loader LoaderFn,
+	) (interface{}, error)
+	WithLoadLock(opts *LoadLockOptions) Cache
+	GetOrRefresh(
+		ctx context.Context,
+		key string,
+		opts *RefreshOptions,
+		loader LoaderFn,
+	) (interface{}, error)
+	GetManyCtx(ctx context.Context, keys []string) (*BulkResult, error)
+	SetManyCtx(
+		ctx context.Context,
+		items map[string]interface{},
+		expiration time.Duration,
+	) error
+	DeleteManyCtx(ctx context.Context, keys []string) error
+	ScanCtx(ctx context.Context, pattern string, batch int64) KeyIterator
+	DeletePattern(pattern string) (int, error)
+	DeletePatternCtx(ctx context.Context, pattern string) (int, error)
+	SetWithTagsCtx(
+		ctx context.Context,
+		key string,
+		value interface{},
+		expiration time.Duration,
+		tags ...string,
+	) error
+	InvalidateTagCtx(ctx context.Context, tag string) error
+	IncrementCtx(ctx context.Context, key string, delta int64) (int64, error)
+	SetIfAbsentCtx(
+		ctx context.Context,
+		key string,
+		value interface{},
+		expiration time.Duration,
+	) (bool, error)
+	CompareAndSwapCtx(
+		ctx context.Context,
+		key string,
+		old interface{},
+		value interface{},
+		expiration time.Duration,
+	) (bool, error)
+	Export(ctx context.Context, w io.Writer) (int, error)
+	ExportPattern(ctx context.Context, w io.Writer, pattern string) (int, error)
+	Import(ctx context.Context, r io.Reader) (int, error)
+	Warm(
+		ctx context.Context,
+		keys []string,
+		opts *WarmOptions,
+		loader WarmFn,
+	) (int, error)
 }
 
 // Deprecated: will be retired soon
 type cacheImpl struct {
-	typ    string
-	name   string
-	redis  *redis.Client
-	mem    *gc.Cache
-	tracer *tracer.AppInsightsCore
-	lgr    *zap.Logger
+	typ          string
+	name         string
+	version      int
+	prefix       string
+	redis        redis.UniversalClient
+	mem          memStore
+	hook         Hook
+	lgr          *zap.Logger
+	l1TTL        time.Duration
+	bus          InvalidationBus
+	subscription *subscription
+	origin       string
+	flights      *flightGroup
+	loadLock     *LoadLockOptions
+	tags         *tagIndex
+	locks        *memoryLockBackend
+	health       *healthMonitor
+	metrics      *cacheMetrics
+	evictions    *evictionTracker
+	disk         *diskStore
+	layers       *valueLayers
 }
 
 // Deprecated: will be retired soon
 // InitRedisCache initializes cache with redis type
 // params:
-//   - url: redis url
+//   - url: redis url, rediss:// enables TLS
 //
 // returns:
 //   - Cache: cache instance
@@ -66,13 +147,7 @@ func InitRedisCache(
 	if err != nil {
 		return nil, err
 	}
-	client := redis.NewClient(opt)
-	c := &cacheImpl{
-		typ:   REDIS_CACHE_TYPE,
-		redis: client,
-	}
-	c.ping()
-	return c, nil
+	return InitRedisCacheWithOptions(opt)
 }
 
 // Deprecated: will be retired soon
@@ -87,10 +162,18 @@ func InitMemoryCache(
 	expiration time.Duration,
 	cleanupInterval time.Duration,
 ) Cache {
+	metrics := metricsFor("", MEMORY_CACHE_TYPE)
 	c := &cacheImpl{
-		typ: MEMORY_CACHE_TYPE,
-		mem: gc.New(expiration, cleanupInterval),
+		typ:       MEMORY_CACHE_TYPE,
+		mem:       newGoCacheStore(expiration, cleanupInterval),
+		lgr:       zap.NewNop(),
+		flights:   newFlightGroup(),
+		tags:      newTagIndex(),
+		locks:     newMemoryLockBackend(),
+		metrics:   metrics,
+		evictions: newEvictionTracker(metrics),
 	}
+	c.watchEvictions()
 	return c
 }
 
@@ -102,95 +185,56 @@ func InitMemoryCache(
 // returns:
 //   - Cache: cache instance
 func (c *cacheImpl) WithLogger(l *zap.Logger) Cache {
-	newC := &cacheImpl{}
-	if c.redis != nil {
-		newC.redis = c.redis
-	}
-	if c.mem != nil {
-		newC.mem = c.mem
-	}
-	newC.typ = c.typ
-	newC.name = c.name
-	if c.tracer != nil {
-		newC.tracer = c.tracer
-	}
+	newC := c.clone()
 	newC.lgr = l
+	if newC.lgr == nil {
+		newC.lgr = zap.NewNop()
+	}
+	newC.reportHealth()
 	return newC
 }
 
 // Deprecated: will be retired soon
-// WithName returns a new instance of Cache with a new name
+// WithName returns a new instance of Cache namespaced under the name, keys are stored
+// as "name:key" so named caches sharing a backend never collide, Keys and ScanCtx
+// return them without the prefix and metrics are reported under the name
 // params:
 //   - name: name
 //
 // returns:
 //   - Cache: cache instance
 func (c *cacheImpl) WithName(name string) Cache {
-	newC := &cacheImpl{}
-	if c.redis != nil {
-		newC.redis = c.redis
-	}
-	if c.mem != nil {
-		newC.mem = c.mem
-	}
-	newC.typ = c.typ
+	newC := c.clone()
 	newC.name = name
-	if c.tracer != nil {
-		newC.tracer = c.tracer
-	}
-	if c.lgr != nil {
-		newC.lgr = c.lgr
+	newC.prefix = namespacePrefix(name, c.version)
+	newC.metrics = metricsFor(name, c.typ)
+	if newC.evictions != nil {
+		newC.evictions.track(newC.prefix, newC.metrics)
 	}
 	return newC
 }
 
 // Deprecated: will be retired soon
-// WithTracer returns a new instance of Cache with a new tracer
+// WithTracer returns a new instance of Cache with a new tracer, prefer WithHook with NewAppInsightsHook
 // params:
 //   - t: tracer
 //
 // returns:
 //   - Cache: cache instance
 func (c *cacheImpl) WithTracer(t *tracer.AppInsightsCore) Cache {
-	newC := &cacheImpl{}
-	if c.redis != nil {
-		newC.redis = c.redis
-	}
-	if c.mem != nil {
-		newC.mem = c.mem
-	}
-	newC.typ = c.typ
-	newC.name = c.name
-	newC.tracer = t
-	if c.lgr != nil {
-		newC.lgr = c.lgr
+	newC := c.clone()
+	newC.hook = nil
+	if t != nil {
+		newC.hook = NewAppInsightsHook(t)
 	}
+	newC.reportHealth()
 	return newC
 }
 
-// Deprecated: will be retired soon
-func (c *cacheImpl) ping() {
-	crashLgr, err := zap.NewProduction()
-	if err != nil {
-		panic("Could not create logger for redis dependency: " + err.Error())
-	}
-	go func() {
-		for {
-			_, err := c.redis.Ping().Result()
-			if err != nil {
-				crashLgr.Error("Redis ping failed", zap.Error(err))
-				if c.tracer != nil {
-					c.tracer.TraceException(context.TODO(), err, 0, map[string]string{
-						"error":     "Redis ping failed",
-						"message":   err.Error(),
-						"cacheType": c.typ,
-						"time":      time.Now().UTC().Format(time.RFC3339Nano),
-					})
-				}
-			}
-			time.Sleep(5 * time.Second)
-		}
-	}()
+// clone returns a shallow copy of the cache, backends are shared between copies
+func (c *cacheImpl) clone() *cacheImpl {
+	newC := *c
+	return &newC
 }
 
 // ===============================================================================	Core	Funcs	=========================================================================
@@ -216,62 +260,42 @@ func (c *cacheImpl) Get(key string) (interface{}, error) {
 //   - interface{}: value
 //   - error: error if any
 func (c *cacheImpl) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	key = c.key(key)
 	now := time.Now()
-	var res interface{}
-	var err error
-	switch c.typ {
-	case REDIS_CACHE_TYPE:
-		res, err = c.fetchFromRedisCache(ctx, key)
-	case MEMORY_CACHE_TYPE:
-		res, err = c.fetchFromMemcache(ctx, key)
+	res, err := c.fetch(ctx, key)
+	if err == nil {
+		res, err = c.decode(key, res)
 	}
 	end := time.Now()
+	c.record(ctx, "GET", now, end, err, map[string]string{"key": key})
+	if err == nil {
+		c.metrics.hit(1)
+	} else if isMiss(err) {
+		c.metrics.miss(1)
+	}
 	if err != nil {
 		c.lgr.Error("[Cache] Error fetching from cache", zap.String("key", key), zap.Error(err))
-		if c.tracer != nil {
-			c.tracer.TraceException(ctx, err, 0, map[string]string{
-				"error":     "Error fetching from cache",
-				"message":   "Error fetching from cache",
-				"cacheType": c.typ,
-				"elasped":   end.Sub(now).String(),
-			})
-			c.tracer.TraceDependency(
-				ctx,
-				"000",
-				c.typ,
-				c.tracer.ServName,
-				"GET",
-				false,
-				now,
-				end,
-				map[string]string{
-					"cacheType": c.typ,
-					"key":       key,
-				},
-			)
-		}
 		return nil, err
 	}
 	c.lgr.Info("[Cache] Get", zap.String("key", key), zap.String("elasped", end.Sub(now).String()))
-	if c.tracer != nil {
-		c.tracer.TraceDependency(
-			ctx,
-			"000",
-			c.typ,
-			c.tracer.ServName,
-			"GET",
-			true,
-			now,
-			end,
-			map[string]string{
-				"cacheType": c.typ,
-				"key":       key,
-			},
-		)
-	}
 	return res, nil
 }
 
+// fetch reads the stored value of a key from the backend
+func (c *cacheImpl) fetch(ctx context.Context, key string) (interface{}, error) {
+	switch c.typ {
+	case REDIS_CACHE_TYPE:
+		return c.fetchFromRedisCache(ctx, key)
+	case MEMORY_CACHE_TYPE:
+		return c.fetchFromMemcache(ctx, key)
+	case TWO_TIER_CACHE_TYPE:
+		return c.fetchFromTwoTierCache(ctx, key)
+	case DISK_CACHE_TYPE:
+		return c.fetchFromDiskCache(ctx, key)
+	}
+	return nil, nil
+}
+
 // Deprecated: will be retired soon
 // Set sets the value for the given key
 // params:
@@ -294,58 +318,30 @@ func (c *cacheImpl) Set(key string, value interface{}) error {
 // returns:
 //   - error: error if any
 func (c *cacheImpl) SetCtx(ctx context.Context, key string, value interface{}) error {
+	key = c.key(key)
+	value, err := c.encode(key, value)
+	if err != nil {
+		return err
+	}
 	now := time.Now()
-	var err error
 	switch c.typ {
 	case REDIS_CACHE_TYPE:
 		err = c.setRedisCache(ctx, key, value)
 	case MEMORY_CACHE_TYPE:
 		err = c.setMemcache(ctx, key, value)
+	case TWO_TIER_CACHE_TYPE:
+		err = c.setTwoTierCache(ctx, key, value)
+	case DISK_CACHE_TYPE:
+		err = c.setWithExpiryDiskCache(ctx, key, value, 0)
 	}
 	end := time.Now()
+	c.record(ctx, "SET", now, end, err, map[string]string{"key": key})
 	if err != nil {
 		c.lgr.Error("[Cache] Error setting cache", zap.String("key", key), zap.Error(err))
-		if c.tracer != nil {
-			c.tracer.TraceException(ctx, err, 0, map[string]string{
-				"error":     "Error setting cache",
-				"message":   "Error setting cache",
-				"cacheType": c.typ,
-				"elasped":   end.Sub(now).String(),
-			})
-			c.tracer.TraceDependency(
-				ctx,
-				"000",
-				c.typ,
-				c.tracer.ServName,
-				"SET",
-				false,
-				now,
-				end,
-				map[string]string{
-					"cacheType": c.typ,
-					"key":       key,
-				},
-			)
-		}
 		return err
 	}
+	c.publishInvalidation(ctx, key)
 	c.lgr.Info("[Cache] Set", zap.String("key", key), zap.String("elasped", end.Sub(now).String()))
-	if c.tracer != nil {
-		c.tracer.TraceDependency(
-			ctx,
-			"000",
-			c.typ,
-			c.tracer.ServName,
-			"SET",
-			true,
-			now,
-			end,
-			map[string]string{
-				"cacheType": c.typ,
-				"key":       key,
-			},
-		)
-	}
 	return nil
 }
 
@@ -369,6 +365,7 @@ func (c *cacheImpl) Delete(key string) error {
 // returns:
 //   - error: error if any
 func (c *cacheImpl) DeleteCtx(ctx context.Context, key string) error {
+	key = c.key(key)
 	now := time.Now()
 	var err error
 	switch c.typ {
@@ -376,55 +373,23 @@ func (c *cacheImpl) DeleteCtx(ctx context.Context, key string) error {
 		err = c.deleteFromRedisCache(ctx, key)
 	case MEMORY_CACHE_TYPE:
 		err = c.deleteFromMemcache(ctx, key)
+	case TWO_TIER_CACHE_TYPE:
+		err = c.deleteFromTwoTierCache(ctx, key)
+	case DISK_CACHE_TYPE:
+		err = c.deleteFromDiskCache(ctx, key)
 	}
 	end := time.Now()
+	c.record(ctx, "DEL", now, end, err, map[string]string{"key": key})
 	if err != nil {
 		c.lgr.Error("[Cache] Error deleting cache", zap.String("key", key), zap.Error(err))
-		if c.tracer != nil {
-			c.tracer.TraceException(ctx, err, 0, map[string]string{
-				"error":     "Error deleting cache",
-				"message":   "Error deleting cache",
-				"cacheType": c.typ,
-				"elasped":   end.Sub(now).String(),
-			})
-			c.tracer.TraceDependency(
-				ctx,
-				"000",
-				c.typ,
-				c.tracer.ServName,
-				"DEL",
-				false,
-				now,
-				end,
-				map[string]string{
-					"cacheType": c.typ,
-					"key":       key,
-				},
-			)
-		}
 		return err
 	}
+	c.publishInvalidation(ctx, key)
 	c.lgr.Info(
 		"[Cache] Delete",
 		zap.String("key", key),
 		zap.String("elasped", end.Sub(now).String()),
 	)
-	if c.tracer != nil {
-		c.tracer.TraceDependency(
-			ctx,
-			"000",
-			c.typ,
-			c.tracer.ServName,
-			"DEL",
-			true,
-			now,
-			end,
-			map[string]string{
-				"cacheType": c.typ,
-				"key":       key,
-			},
-		)
-	}
 	return nil
 }
 
@@ -458,36 +423,19 @@ func (c *cacheImpl) KeysCtx(ctx context.Context, pattern string) ([]string, erro
 		res, err = c.fetchKeysFromRedisCache(ctx, pattern)
 	case MEMORY_CACHE_TYPE:
 		res, err = c.fetchKeysFromMemcache(ctx, pattern)
+	case TWO_TIER_CACHE_TYPE:
+		res, err = c.fetchKeysFromRedisCache(ctx, pattern)
+	case DISK_CACHE_TYPE:
+		res, err = c.fetchKeysFromDiskCache(ctx, pattern)
 	}
 	end := time.Now()
+	c.record(ctx, "KEYS", now, end, err, map[string]string{"pattern": pattern})
 	if err != nil {
 		c.lgr.Error(
 			"[Cache] Error fetching keys from cache",
 			zap.String("pattern", pattern),
 			zap.Error(err),
 		)
-		if c.tracer != nil {
-			c.tracer.TraceException(ctx, err, 0, map[string]string{
-				"error":     "Error fetching keys from cache",
-				"message":   "Error fetching keys from cache",
-				"cacheType": c.typ,
-				"elasped":   end.Sub(now).String(),
-			})
-			c.tracer.TraceDependency(
-				ctx,
-				"000",
-				c.typ,
-				c.tracer.ServName,
-				"KEYS",
-				false,
-				now,
-				end,
-				map[string]string{
-					"cacheType": c.typ,
-					"pattern":   pattern,
-				},
-			)
-		}
 		return nil, err
 	}
 	c.lgr.Info(
@@ -495,22 +443,6 @@ func (c *cacheImpl) KeysCtx(ctx context.Context, pattern string) ([]string, erro
 		zap.String("pattern", pattern),
 		zap.String("elasped", end.Sub(now).String()),
 	)
-	if c.tracer != nil {
-		c.tracer.TraceDependency(
-			ctx,
-			"000",
-			c.typ,
-			c.tracer.ServName,
-			"KEYS",
-			true,
-			now,
-			end,
-			map[string]string{
-				"cacheType": c.typ,
-				"pattern":   pattern,
-			},
-		)
-	}
 	return res, nil
 }
 
@@ -530,60 +462,33 @@ func (c *cacheImpl) SetWithExpirationCtx(
 	value interface{},
 	expiration time.Duration,
 ) error {
+	key = c.key(key)
+	value, err := c.encode(key, value)
+	if err != nil {
+		return err
+	}
 	now := time.Now()
-	var err error
 	switch c.typ {
 	case REDIS_CACHE_TYPE:
 		err = c.setWithExpiryRedisCache(ctx, key, value, expiration)
 	case MEMORY_CACHE_TYPE:
 		err = c.setWithExpiryMemcache(ctx, key, value, expiration)
+	case TWO_TIER_CACHE_TYPE:
+		err = c.setWithExpiryTwoTierCache(ctx, key, value, expiration)
+	case DISK_CACHE_TYPE:
+		err = c.setWithExpiryDiskCache(ctx, key, value, expiration)
 	}
 	end := time.Now()
+	c.record(ctx, "SET", now, end, err, map[string]string{
+		"key":        key,
+		"expiration": expiration.String(),
+	})
 	if err != nil {
 		c.lgr.Error("[Cache] Error setting cache", zap.String("key", key), zap.Error(err))
-		if c.tracer != nil {
-			c.tracer.TraceException(ctx, err, 0, map[string]string{
-				"error":     "Error setting cache",
-				"message":   "Error setting cache",
-				"cacheType": c.typ,
-				"elasped":   end.Sub(now).String(),
-			})
-			c.tracer.TraceDependency(
-				ctx,
-				"000",
-				c.typ,
-				c.tracer.ServName,
-				"SET",
-				false,
-				now,
-				end,
-				map[string]string{
-					"cacheType":  c.typ,
-					"key":        key,
-					"expiration": expiration.String(),
-				},
-			)
-		}
 		return err
 	}
+	c.publishInvalidation(ctx, key)
 	c.lgr.Info("[Cache] Set", zap.String("key", key), zap.String("elasped", end.Sub(now).String()))
-	if c.tracer != nil {
-		c.tracer.TraceDependency(
-			ctx,
-			"000",
-			c.typ,
-			c.tracer.ServName,
-			"SET",
-			true,
-			now,
-			end,
-			map[string]string{
-				"cacheType":  c.typ,
-				"key":        key,
-				"expiration": expiration.String(),
-			},
-		)
-	}
 	return nil
 }
 
@@ -610,7 +515,10 @@ func (c *cacheImpl) fetchFromRedisCache(
 	ctx context.Context,
 	key string,
 ) (interface{}, error) {
-	return c.redis.Get(key).Result()
+	if err := c.available(); err != nil {
+		return nil, err
+	}
+	return c.redis.Get(ctx, key).Result()
 }
 
 // Deprecated: will be retired soon
@@ -619,7 +527,10 @@ func (c *cacheImpl) setRedisCache(
 	key string,
 	value interface{},
 ) error {
-	return c.redis.Set(key, value, 0).Err()
+	if err := c.available(); err != nil {
+		return err
+	}
+	return c.redis.Set(ctx, key, value, 0).Err()
 }
 
 // Deprecated: will be retired soon
@@ -627,7 +538,10 @@ func (c *cacheImpl) deleteFromRedisCache(
 	ctx context.Context,
 	key string,
 ) error {
-	return c.redis.Del(key).Err()
+	if err := c.available(); err != nil {
+		return err
+	}
+	return c.redis.Del(ctx, key).Err()
 }
 
 // Deprecated: will be retired soon
@@ -635,7 +549,18 @@ func (c *cacheImpl) fetchKeysFromRedisCache(
 	ctx context.Context,
 	key string,
 ) ([]string, error) {
-	return c.redis.Keys(key).Result()
+	// SCAN may return a key more than once
+	seen := map[string]struct{}{}
+	res := []string{}
+	it := c.ScanCtx(ctx, key, default_scan_batch)
+	for it.Next(ctx) {
+		if _, ok := seen[it.Key()]; ok {
+			continue
+		}
+		seen[it.Key()] = struct{}{}
+		res = append(res, it.Key())
+	}
+	return res, it.Err()
 }
 
 // Deprecated: will be retired soon
@@ -645,7 +570,10 @@ func (c *cacheImpl) setWithExpiryRedisCache(
 	value interface{},
 	expiry time.Duration,
 ) error {
-	return c.redis.Set(key, value, expiry).Err()
+	if err := c.available(); err != nil {
+		return err
+	}
+	return c.redis.Set(ctx, key, value, expiry).Err()
 }
 
 // ===============================================================================	Memory	Cache	=========================================================================
@@ -666,20 +594,23 @@ func (c *cacheImpl) setMemcache(ctx context.Context, key string, value interface
 
 // Deprecated: will be retired soon
 func (c *cacheImpl) deleteFromMemcache(ctx context.Context, key string) error {
-	c.mem.Delete(key)
+	c.deleteMem(key)
 	return nil
 }
 
 // Deprecated: will be retired soon
+// fetchKeysFromMemcache keeps the substring matching memory caches had before glob
+// patterns, a pattern without glob characters matches the keys containing it
 func (c *cacheImpl) fetchKeysFromMemcache(ctx context.Context, pattern string) ([]string, error) {
-	keys := c.mem.Items()
+	if pattern != "" && !strings.ContainsAny(pattern, "*?[\\") {
+		pattern = "*" + pattern + "*"
+	}
 	var res []string
-	for key := range keys {
-		if strings.Contains(key, pattern) {
-			res = append(res, key)
-		}
+	it := c.ScanCtx(ctx, pattern, default_scan_batch)
+	for it.Next(ctx) {
+		res = append(res, it.Key())
 	}
-	return res, nil
+	return res, it.Err()
 }
 
 // Deprecated: will be retired soon
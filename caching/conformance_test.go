@@ -0,0 +1,156 @@
+package caching
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// conformanceBackends returns a fresh cache of every backend, closed when the test ends
+func conformanceBackends() []struct {
+	name string
+	init func(t *testing.T) Cache
+} {
+	return []struct {
+		name string
+		init func(t *testing.T) Cache
+	}{
+		{"memory", func(t *testing.T) Cache {
+			return InitMemoryCache(time.Minute, time.Minute)
+		}},
+		{"bounded", func(t *testing.T) Cache {
+			c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{
+				MaxEntries: 100,
+				Policy:     TINY_LFU_EVICTION_POLICY,
+			})
+			assert.Nil(t, err)
+			return c
+		}},
+		{"disk", func(t *testing.T) Cache {
+			return initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+		}},
+		{"redis", func(t *testing.T) Cache {
+			c, err := InitRedisCache(testRedisURI(t))
+			assert.Nil(t, err)
+			return c
+		}},
+		{"two_tier", func(t *testing.T) Cache {
+			c, err := InitTwoTierCache(testRedisURI(t), nil)
+			assert.Nil(t, err)
+			return c
+		}},
+		{"cluster", func(t *testing.T) Cache {
+			c, err := InitRedisClusterCache(&redis.ClusterOptions{
+				Addrs: []string{testRedisClusterAddr(t)},
+			})
+			assert.Nil(t, err)
+			return c
+		}},
+	}
+}
+
+// testLockerSuite runs the locker fixtures on the locks of c, skipping caches without locks
+func testLockerSuite(t *testing.T, c Cache, prefix string) {
+	l, err := NewLocker(c, &LockerOptions{RetryInterval: 5 * time.Millisecond})
+	if err == Err_UNSUPPORTED_LOCKER {
+		t.Skip("the backend has no locks")
+	}
+	assert.Nil(t, err)
+	testLocker(t, l, prefix+"job")
+	testLockerExtension(t, l, prefix+"extension")
+}
+
+// testSnapshotSuite moves a snapshot from c to a memory cache and back
+func testSnapshotSuite(t *testing.T, c Cache, prefix string) {
+	testSnapshot(t, c, InitMemoryCache(time.Minute, time.Minute), prefix)
+	testSnapshot(t, InitMemoryCache(time.Minute, time.Minute), c, prefix)
+}
+
+// TestConformance runs the behavior every backend shares on each of them
+func TestConformance(t *testing.T) {
+	suites := []struct {
+		name string
+		run  func(t *testing.T, c Cache, prefix string)
+	}{
+		{"bulk", testBulkOperations},
+		{"atomic", testAtomicOperations},
+		{"layers", testLayers},
+		{"namespaces", testNamespaces},
+		{"scan", testScan},
+		{"snapshot", testSnapshotSuite},
+		{"tags", testTags},
+		{"locker", testLockerSuite},
+	}
+	for _, backend := range conformanceBackends() {
+		for _, suite := range suites {
+			backend, suite := backend, suite
+			t.Run(backend.name+"/"+suite.name, func(t *testing.T) {
+				c := backend.init(t)
+				defer c.Close()
+				suite.run(t, c, suite.name+"_"+backend.name+"_")
+			})
+		}
+	}
+}
+
+// TestMockConformance checks the mocks answer every operation the way they are documented,
+// the success mock always succeeds and the failed mock always fails
+func TestMockConformance(t *testing.T) {
+	ctx := context.Background()
+	ops := []struct {
+		name string
+		run  func(c Cache) error
+	}{
+		{"GetManyCtx", func(c Cache) error {
+			_, err := c.GetManyCtx(ctx, []string{"test"})
+			return err
+		}},
+		{"SetManyCtx", func(c Cache) error {
+			return c.SetManyCtx(ctx, map[string]interface{}{"test": "v"}, time.Minute)
+		}},
+		{"DeleteManyCtx", func(c Cache) error {
+			return c.DeleteManyCtx(ctx, []string{"test"})
+		}},
+		{"IncrementCtx", func(c Cache) error {
+			_, err := c.IncrementCtx(ctx, "key", 1)
+			return err
+		}},
+		{"SetIfAbsentCtx", func(c Cache) error {
+			_, err := c.SetIfAbsentCtx(ctx, "key", "v", 0)
+			return err
+		}},
+		{"CompareAndSwapCtx", func(c Cache) error {
+			_, err := c.CompareAndSwapCtx(ctx, "key", "v", "w", 0)
+			return err
+		}},
+		{"ScanCtx", func(c Cache) error {
+			it := c.ScanCtx(ctx, "*", 10)
+			for it.Next(ctx) {
+			}
+			return it.Err()
+		}},
+		{"SetWithTagsCtx", func(c Cache) error {
+			return c.SetWithTagsCtx(ctx, "key", "v", time.Minute, "tag")
+		}},
+		{"InvalidateTagCtx", func(c Cache) error {
+			return c.InvalidateTagCtx(ctx, "tag")
+		}},
+	}
+	for _, op := range ops {
+		op := op
+		t.Run(op.name, func(t *testing.T) {
+			assert.Nil(t, op.run(createSuccessMockCacher()))
+			assert.NotNil(t, op.run(createFailedMockCacher()))
+		})
+	}
+	res, err := createSuccessMockCacher().GetManyCtx(ctx, []string{"test"})
+	assert.Nil(t, err)
+	assert.Equal(t, true, res.Found["test"])
+	res, err = createFailedMockCacher().GetManyCtx(ctx, []string{"test"})
+	assert.NotNil(t, err)
+	assert.Nil(t, res)
+}
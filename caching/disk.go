@@ -0,0 +1,484 @@
+package caching
+
+import (
+	"context"
+	"database/sql"
+	"encoding"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+// DiskOptions configures an on-disk cache
+// params:
+//   - Expiration: default expiration of the entries, 0 means no expiration
+//   - CompactionInterval: how often expired entries are purged and the file is
+//     shrunk, defaults to 10 minutes, a negative interval disables compaction
+type DiskOptions struct {
+	Expiration         time.Duration
+	CompactionInterval time.Duration
+}
+
+const disk_schema = `
+CREATE TABLE IF NOT EXISTS cache_entries (
+	key TEXT PRIMARY KEY,
+	value BLOB NOT NULL,
+	expires_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS cache_entries_expires_at ON cache_entries(expires_at) WHERE expires_at > 0;
+CREATE TABLE IF NOT EXISTS cache_tags (
+	tag TEXT NOT NULL,
+	key TEXT NOT NULL,
+	PRIMARY KEY (tag, key)
+);
+`
+
+const disk_upsert = `INSERT INTO cache_entries (key, value, expires_at) VALUES (?, ?, ?)
+ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`
+
+type diskStore struct {
+	db         *sql.DB
+	expiration time.Duration
+	stop       chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+// InitDiskCache initializes cache with disk type, entries are kept in a sqlite
+// database and survive restarts
+// params:
+//   - path: path of the database file, created when missing
+//   - opts: options, defaults are used when nil
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitDiskCache(
+	path string,
+	opts *DiskOptions,
+) (Cache, error) {
+	if opts == nil {
+		opts = &DiskOptions{}
+	}
+	if opts.CompactionInterval == 0 {
+		opts.CompactionInterval = 10 * time.Minute
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes writers instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	pragmas := []string{
+		"PRAGMA auto_vacuum = INCREMENTAL",
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA busy_timeout = 5000",
+	}
+	for _, pragma := range pragmas {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if _, err := db.Exec(disk_schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	metrics := metricsFor("", DISK_CACHE_TYPE)
+	c := &cacheImpl{
+		typ:       DISK_CACHE_TYPE,
+		lgr:       zap.NewNop(),
+		flights:   newFlightGroup(),
+		metrics:   metrics,
+		evictions: newEvictionTracker(metrics),
+		disk: &diskStore{
+			db:         db,
+			expiration: opts.Expiration,
+			stop:       make(chan struct{}),
+			done:       make(chan struct{}),
+		},
+	}
+	if opts.CompactionInterval > 0 {
+		go c.disk.compactor(opts.CompactionInterval, c.evictions)
+	} else {
+		close(c.disk.done)
+	}
+	return c, nil
+}
+
+func (s *diskStore) compactor(interval time.Duration, evictions *evictionTracker) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if keys, err := s.compact(context.Background()); err == nil {
+				evictions.expired(keys)
+			}
+		}
+	}
+}
+
+// compact purges the expired entries and their tags and returns the freed pages to the file system
+// returns the purged keys
+func (s *diskStore) compact(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		"DELETE FROM cache_entries WHERE expires_at > 0 AND expires_at <= ? RETURNING key",
+		time.Now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		"DELETE FROM cache_tags WHERE key NOT IN (SELECT key FROM cache_entries)",
+	)
+	if err != nil {
+		return keys, err
+	}
+	_, err = s.db.ExecContext(ctx, "PRAGMA incremental_vacuum")
+	return keys, err
+}
+
+func (s *diskStore) close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		s.closeErr = s.db.Close()
+	})
+	return s.closeErr
+}
+
+// expiresAt converts a ttl to the stored deadline, 0 means no expiration
+func (s *diskStore) expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		ttl = s.expiration
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+// encodeDiskValue converts a value to bytes with the same rules as redis
+func encodeDiskValue(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), nil
+	case uint:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(nil, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case time.Time:
+		return v.AppendFormat(nil, time.RFC3339Nano), nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	default:
+		return nil, fmt.Errorf(
+			"caching: can't marshal %T (implement encoding.BinaryMarshaler)", value,
+		)
+	}
+}
+
+// ===============================================================================	Disk	Cache	=========================================================================
+func (c *cacheImpl) fetchFromDiskCache(ctx context.Context, key string) (interface{}, error) {
+	var value []byte
+	var expiresAt int64
+	err := c.disk.db.QueryRowContext(
+		ctx,
+		"SELECT value, expires_at FROM cache_entries WHERE key = ?",
+		key,
+	).Scan(&value, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, Err_KEY_NOT_FOUND
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt > 0 && expiresAt <= time.Now().UnixNano() {
+		return nil, Err_KEY_NOT_FOUND
+	}
+	// values come back as strings, like they do from redis
+	return string(value), nil
+}
+
+func (c *cacheImpl) setWithExpiryDiskCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiry time.Duration,
+) error {
+	byts, err := encodeDiskValue(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.disk.db.ExecContext(
+		ctx,
+		disk_upsert,
+		key,
+		byts,
+		c.disk.expiresAt(expiry),
+	)
+	return err
+}
+
+func (c *cacheImpl) fetchKeysFromDiskCache(ctx context.Context, pattern string) ([]string, error) {
+	res := []string{}
+	it := c.ScanCtx(ctx, pattern, default_scan_batch)
+	for it.Next(ctx) {
+		res = append(res, it.Key())
+	}
+	return res, it.Err()
+}
+
+func (c *cacheImpl) deleteFromDiskCache(ctx context.Context, key string) error {
+	_, err := c.disk.db.ExecContext(ctx, "DELETE FROM cache_entries WHERE key = ?", key)
+	return err
+}
+
+func (c *cacheImpl) fetchManyFromDiskCache(
+	ctx context.Context,
+	keys []string,
+	res *BulkResult,
+) error {
+	for _, key := range keys {
+		v, err := c.fetchFromDiskCache(ctx, key)
+		if err == Err_KEY_NOT_FOUND {
+			res.Missing = append(res.Missing, key)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		res.Found[key] = v
+	}
+	return nil
+}
+
+func (c *cacheImpl) setManyDiskCache(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	tx, err := c.disk.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	expiresAt := c.disk.expiresAt(expiration)
+	for k, v := range items {
+		byts, err := encodeDiskValue(v)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			disk_upsert,
+			k,
+			byts,
+			expiresAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *cacheImpl) deleteManyFromDiskCache(ctx context.Context, keys []string) error {
+	tx, err := c.disk.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM cache_entries WHERE key = ?", key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *cacheImpl) setWithTagsDiskCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiry time.Duration,
+	tags []string,
+) error {
+	byts, err := encodeDiskValue(value)
+	if err != nil {
+		return err
+	}
+	tx, err := c.disk.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(
+		ctx,
+		disk_upsert,
+		key,
+		byts,
+		c.disk.expiresAt(expiry),
+	)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT OR IGNORE INTO cache_tags (tag, key) VALUES (?, ?)",
+			tag,
+			key,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// popDiskTag reads and removes a tag in one transaction
+func (c *cacheImpl) popDiskTag(ctx context.Context, tag string) ([]string, error) {
+	tx, err := c.disk.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, "SELECT key FROM cache_tags WHERE tag = ?", tag)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM cache_tags WHERE tag = ?", tag); err != nil {
+		return nil, err
+	}
+	return keys, tx.Commit()
+}
+
+type diskKeyIterator struct {
+	c       *cacheImpl
+	pattern string
+	batch   int64
+	last    string
+	started bool
+	done    bool
+	buf     []string
+	key     string
+	err     error
+}
+
+// Next pages through the keys in order, the glob is matched in go so it
+// follows the same rules as the other backends
+func (it *diskKeyIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if it.err != nil || it.done {
+			return false
+		}
+		it.fetch(ctx)
+	}
+	it.key = it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+func (it *diskKeyIterator) fetch(ctx context.Context) {
+	rows, err := it.c.disk.db.QueryContext(
+		ctx,
+		`SELECT key FROM cache_entries
+		WHERE (? OR key > ?) AND (expires_at = 0 OR expires_at > ?)
+		ORDER BY key LIMIT ?`,
+		!it.started,
+		it.last,
+		time.Now().UnixNano(),
+		it.batch,
+	)
+	if err != nil {
+		it.err = err
+		return
+	}
+	defer rows.Close()
+	it.started = true
+	n := int64(0)
+	for rows.Next() {
+		var key string
+		if it.err = rows.Scan(&key); it.err != nil {
+			return
+		}
+		n++
+		it.last = key
+		if matchGlob(it.pattern, key) {
+			it.buf = append(it.buf, key)
+		}
+	}
+	it.err = rows.Err()
+	it.done = n < it.batch
+}
+
+func (it *diskKeyIterator) Key() string { return it.key }
+
+func (it *diskKeyIterator) Err() error { return it.err }
@@ -0,0 +1,120 @@
+package caching
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initTestDiskCache(t *testing.T, path string, opts *DiskOptions) Cache {
+	c, err := InitDiskCache(path, opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestDiskSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	c, err := InitDiskCache(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetCtx(ctx, "key", "value"))
+	assert.Nil(t, c.SetCtx(ctx, "count", 42))
+	assert.Nil(t, c.SetCtx(ctx, "deleted", "value"))
+	assert.Nil(t, c.DeleteCtx(ctx, "deleted"))
+	assert.Nil(t, c.Close())
+	assert.Nil(t, c.Close())
+
+	c = initTestDiskCache(t, path, nil)
+	v, err := c.GetCtx(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", v)
+	v, err = c.GetCtx(ctx, "count")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", v)
+	_, err = c.GetCtx(ctx, "deleted")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+}
+
+func TestDiskExpiration(t *testing.T) {
+	ctx := context.Background()
+	c := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), &DiskOptions{
+		CompactionInterval: -1,
+	}).WithName("disk_expiration")
+	assert.Nil(t, c.SetWithExpirationCtx(ctx, "short", "v", time.Millisecond))
+	assert.Nil(t, c.SetWithExpirationCtx(ctx, "long", "v", time.Hour))
+	time.Sleep(5 * time.Millisecond)
+	_, err := c.GetCtx(ctx, "short")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	keys, err := c.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"long"}, keys)
+
+	impl := c.(*cacheImpl)
+	purged, err := impl.disk.compact(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"disk_expiration:short"}, purged)
+}
+
+func TestDiskCompaction(t *testing.T) {
+	ctx := context.Background()
+	c := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), &DiskOptions{
+		Expiration:         time.Millisecond,
+		CompactionInterval: 5 * time.Millisecond,
+	}).WithName("disk_compaction")
+	assert.Nil(t, c.SetWithTagsCtx(ctx, "key", "v", 0, "tag"))
+	assert.Eventually(t, func() bool {
+		return c.Stats().Evictions == 1
+	}, time.Second, 5*time.Millisecond)
+	var tags int
+	impl := c.(*cacheImpl)
+	assert.Nil(t, impl.disk.db.QueryRow("SELECT COUNT(*) FROM cache_tags").Scan(&tags))
+	assert.Equal(t, 0, tags)
+}
+
+func TestDiskGlobMatchesMemory(t *testing.T) {
+	ctx := context.Background()
+	disk := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+	mem := InitMemoryCache(time.Minute, time.Minute)
+	keys := []string{"user:1", "user:2", "user:10", "users:1", "h*llo", "hello", "hallo", ""}
+	for _, key := range keys {
+		assert.Nil(t, disk.SetCtx(ctx, key, "v"))
+		assert.Nil(t, mem.SetCtx(ctx, key, "v"))
+	}
+	for _, pattern := range []string{"*", "user:*", "user:?", "h[ae]llo", "h\\*llo", "[^u]*"} {
+		expected, err := mem.KeysCtx(ctx, pattern)
+		assert.Nil(t, err)
+		actual, err := disk.KeysCtx(ctx, pattern)
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, expected, actual, pattern)
+	}
+	// the iterator pages through the keys
+	it := disk.ScanCtx(ctx, "user:*", 2)
+	found := []string{}
+	for it.Next(ctx) {
+		found = append(found, it.Key())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"user:1", "user:10", "user:2"}, found)
+}
+
+func TestDiskUnsupportedValue(t *testing.T) {
+	c := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+	err := c.SetCtx(context.Background(), "key", struct{ A int }{A: 1})
+	assert.NotNil(t, err)
+}
+
+func TestDiskStore(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	c := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+	store := NewStore[user](c, nil)
+	assert.Nil(t, store.Set("user", user{Name: "karim"}))
+	u, err := store.Get("user")
+	assert.Nil(t, err)
+	assert.Equal(t, "karim", u.Name)
+}
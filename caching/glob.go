@@ -0,0 +1,96 @@
+package caching
+
+// matchGlob reports whether str matches the redis style glob pattern
+// supported syntax:
+//   - * matches any sequence of characters
+//   - ? matches a single character
+//   - [abc], [^abc] and [a-z] match character classes
+//   - \x matches x literally
+func matchGlob(pattern string, str string) bool {
+	p, s := 0, 0
+	// position to resume from after the last * in pattern and str
+	starP, starS := -1, 0
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP = p
+				starS = s
+				p++
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(pattern, p, str[s]); ok && matched {
+					p = next
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == str[s] {
+					p += 2
+					s++
+					continue
+				}
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+		if starP == -1 {
+			return false
+		}
+		// backtrack, let the last * absorb one more character
+		starS++
+		s = starS
+		p = starP + 1
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the character class starting at pattern[start] == '['
+// returns whether it matched, the index after the class and whether the class is well formed
+func matchClass(pattern string, start int, c byte) (bool, int, bool) {
+	i := start + 1
+	negate := false
+	if i < len(pattern) && pattern[i] == '^' {
+		negate = true
+		i++
+	}
+	matched := false
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if c >= lo && c <= hi {
+			matched = true
+		}
+		i++
+	}
+	return false, i, false
+}
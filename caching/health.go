@@ -0,0 +1,274 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+var Err_CACHE_UNAVAILABLE = fmt.Errorf("cache unavailable")
+
+// HealthCheckOptions configures the monitor pinging redis in the background
+// params:
+//   - Interval: time between two pings, defaults to 5 seconds
+//   - Timeout: how long a ping may take before it counts as failed, defaults to a second
+//   - FailureThreshold: consecutive failed pings before redis is marked down, defaults to 3
+//   - CircuitBreaker: while redis is down calls fail fast with Err_CACHE_UNAVAILABLE
+//     and GetOrLoad / GetOrRefresh fall through to the loader
+//   - OnStateChange: optional callback invoked when redis is marked down or recovers
+type HealthCheckOptions struct {
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+	CircuitBreaker   bool
+	OnStateChange    func(healthy bool, err error)
+}
+
+type healthMonitor struct {
+	client      redis.UniversalClient
+	closeClient bool
+	typ         string
+	mtx         sync.RWMutex
+	opts        HealthCheckOptions
+	lgr         *zap.Logger
+	hook        Hook
+	failures    int
+	down        int32
+	reset       chan struct{}
+	stop        chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+	closeErr    error
+}
+
+// newHealthMonitor starts pinging the client with the default options, failed pings
+// are logged with a production logger until WithLogger sets another one
+// closeClient tells whether closing the monitor closes the client as well
+func newHealthMonitor(
+	client redis.UniversalClient,
+	typ string,
+	closeClient bool,
+) *healthMonitor {
+	lgr, err := zap.NewProduction()
+	if err != nil {
+		lgr = zap.NewNop()
+	}
+	h := &healthMonitor{
+		client:      client,
+		closeClient: closeClient,
+		typ:         typ,
+		reset:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	h.configure(nil, lgr, nil)
+	<-h.reset
+	go h.run()
+	return h
+}
+
+func (h *healthMonitor) configure(
+	opts *HealthCheckOptions,
+	lgr *zap.Logger,
+	hook Hook,
+) {
+	cfg := HealthCheckOptions{}
+	if opts != nil {
+		cfg = *opts
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+	h.mtx.Lock()
+	h.opts = cfg
+	h.mtx.Unlock()
+	h.reportTo(lgr, hook)
+	// restart the timer so a new interval applies right away
+	select {
+	case h.reset <- struct{}{}:
+	default:
+	}
+}
+
+// reportTo sets the logger and hook the pings are reported to, the options are kept
+func (h *healthMonitor) reportTo(lgr *zap.Logger, hook Hook) {
+	h.mtx.Lock()
+	h.lgr = lgr
+	h.hook = hook
+	h.mtx.Unlock()
+}
+
+func (h *healthMonitor) run() {
+	defer close(h.done)
+	timer := time.NewTimer(h.options().Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-h.reset:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+			h.check()
+		}
+		timer.Reset(h.options().Interval)
+	}
+}
+
+func (h *healthMonitor) options() HealthCheckOptions {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.opts
+}
+
+func (h *healthMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), h.options().Timeout)
+	defer cancel()
+	start := time.Now()
+	err := h.client.Ping(ctx).Err()
+	h.record(err)
+	if err == nil {
+		return
+	}
+	h.mtx.RLock()
+	hook := h.hook
+	h.mtx.RUnlock()
+	if hook != nil {
+		hook.AfterOperation(context.Background(), Operation{
+			CacheType: h.typ,
+			Command:   "PING",
+		}, start, time.Now(), err)
+	}
+}
+
+// record updates the state with the outcome of a ping
+func (h *healthMonitor) record(err error) {
+	h.mtx.Lock()
+	if err == nil {
+		h.failures = 0
+		recovered := atomic.CompareAndSwapInt32(&h.down, 1, 0)
+		lgr, cb := h.lgr, h.opts.OnStateChange
+		h.mtx.Unlock()
+		if recovered {
+			lgr.Info("[Cache] Redis recovered")
+			if cb != nil {
+				cb(true, nil)
+			}
+		}
+		return
+	}
+	h.failures++
+	markedDown := h.failures >= h.opts.FailureThreshold &&
+		atomic.CompareAndSwapInt32(&h.down, 0, 1)
+	lgr, cb := h.lgr, h.opts.OnStateChange
+	h.mtx.Unlock()
+	lgr.Error("[Cache] Redis ping failed", zap.Error(err))
+	if markedDown {
+		lgr.Error("[Cache] Redis marked down", zap.Error(err))
+		if cb != nil {
+			cb(false, err)
+		}
+	}
+}
+
+func (h *healthMonitor) healthy() bool {
+	return atomic.LoadInt32(&h.down) == 0
+}
+
+// available returns Err_CACHE_UNAVAILABLE when redis is down and the circuit breaker is on
+func (h *healthMonitor) available() error {
+	if h.healthy() || !h.options().CircuitBreaker {
+		return nil
+	}
+	return Err_CACHE_UNAVAILABLE
+}
+
+func (h *healthMonitor) close() error {
+	h.closeOnce.Do(func() {
+		close(h.stop)
+		<-h.done
+		if h.closeClient {
+			h.closeErr = h.client.Close()
+		}
+	})
+	return h.closeErr
+}
+
+// WithHealthCheck returns a new instance of Cache and reconfigures the redis health monitor
+// the monitor is shared by every instance built on the same connection, it reports through
+// the logger and hook of the last instance WithHealthCheck, WithLogger, WithHook or WithTracer
+// returned, failed pings are reported to the hook as "PING" operations, it has no effect on
+// memory caches
+// params:
+//   - opts: health check options, defaults are used when nil
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithHealthCheck(opts *HealthCheckOptions) Cache {
+	newC := c.clone()
+	if newC.health != nil {
+		newC.health.configure(opts, newC.lgr, newC.hook)
+	}
+	return newC
+}
+
+// reportHealth makes the health monitor report through the logger and hook of the cache
+func (c *cacheImpl) reportHealth() {
+	if c.health != nil {
+		c.health.reportTo(c.lgr, c.hook)
+	}
+}
+
+// Healthy reports whether the last pings reached redis, memory caches are always healthy
+//
+// returns:
+//   - bool: health state
+func (c *cacheImpl) Healthy() bool {
+	if c.health == nil {
+		return true
+	}
+	return c.health.healthy()
+}
+
+// Close stops the health monitor, unsubscribes from the invalidation bus and closes the redis connection the cache created
+// clients passed to the *WithClient constructors are left open, calling Close twice is a no-op
+//
+// returns:
+//   - error: error if any
+func (c *cacheImpl) Close() error {
+	c.unsubscribeInvalidations()
+	if c.mem != nil {
+		c.mem.close()
+	}
+	if c.disk != nil {
+		return c.disk.close()
+	}
+	if c.health == nil {
+		return nil
+	}
+	return c.health.close()
+}
+
+// available fails fast while redis is marked down and the circuit breaker is on
+func (c *cacheImpl) available() error {
+	if c.health == nil {
+		return nil
+	}
+	return c.health.available()
+}
@@ -0,0 +1,116 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHealthMemory(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute).WithHealthCheck(nil)
+	assert.True(t, c.Healthy())
+	assert.Nil(t, c.Close())
+}
+
+func TestHealthRecord(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	h := newHealthMonitor(client, REDIS_CACHE_TYPE, true)
+	defer h.close()
+	states := []bool{}
+	h.configure(&HealthCheckOptions{
+		Interval:         time.Hour,
+		FailureThreshold: 2,
+		CircuitBreaker:   true,
+		OnStateChange: func(healthy bool, err error) {
+			states = append(states, healthy)
+		},
+	}, h.lgr, nil)
+
+	pingErr := errors.New("ping failed")
+	h.record(pingErr)
+	assert.True(t, h.healthy())
+	assert.Nil(t, h.available())
+	h.record(pingErr)
+	assert.False(t, h.healthy())
+	assert.Equal(t, Err_CACHE_UNAVAILABLE, h.available())
+	h.record(pingErr)
+	h.record(nil)
+	assert.True(t, h.healthy())
+	assert.Equal(t, []bool{false, true}, states)
+}
+
+func TestHealthCircuitBreaker(t *testing.T) {
+	c, err := InitRedisCacheWithOptions(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	})
+	assert.Nil(t, err)
+	c = c.WithHealthCheck(&HealthCheckOptions{
+		Interval:         10 * time.Millisecond,
+		Timeout:          50 * time.Millisecond,
+		FailureThreshold: 1,
+		CircuitBreaker:   true,
+	})
+	assert.Eventually(t, func() bool { return !c.Healthy() }, time.Second, 10*time.Millisecond)
+
+	ctx := context.Background()
+	_, err = c.GetCtx(ctx, "health_key")
+	assert.Equal(t, Err_CACHE_UNAVAILABLE, err)
+	err = c.SetCtx(ctx, "health_key", "value")
+	assert.Equal(t, Err_CACHE_UNAVAILABLE, err)
+	v, err := c.GetOrLoad(ctx, "health_key", time.Minute, func(ctx context.Context) (interface{}, error) {
+		return "loaded", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded", v)
+
+	assert.Nil(t, c.Close())
+	assert.Nil(t, c.Close())
+}
+
+func TestHealthRedis(t *testing.T) {
+	redisUri := testRedisURI(t)
+	opts, err := redis.ParseURL(redisUri)
+	assert.Nil(t, err)
+	client := redis.NewClient(opts)
+	c, err := InitTwoTierCacheWithClient(client, nil)
+	assert.Nil(t, err)
+	c = c.WithHealthCheck(&HealthCheckOptions{Interval: 10 * time.Millisecond})
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, c.Healthy())
+	assert.Nil(t, c.Close())
+	// the client was passed in, closing the cache leaves it open
+	assert.Nil(t, client.Ping(context.Background()).Err())
+	client.Close()
+}
+
+func TestHealthReportsThroughLogger(t *testing.T) {
+	c, err := InitRedisCacheWithOptions(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	})
+	assert.Nil(t, err)
+	defer c.Close()
+	core, logs := observer.New(zap.ErrorLevel)
+	pings := make(chan Operation, 16)
+	// the logger and hook are set after the monitor was configured
+	c.WithHealthCheck(&HealthCheckOptions{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}).
+		WithLogger(zap.New(core)).
+		WithHook(HookFunc(func(ctx context.Context, op Operation, start, end time.Time, err error) {
+			select {
+			case pings <- op:
+			default:
+			}
+		}))
+	assert.Eventually(t, func() bool {
+		return logs.FilterMessage("[Cache] Redis ping failed").Len() > 0
+	}, time.Second, 10*time.Millisecond)
+	op := <-pings
+	assert.Equal(t, "PING", op.Command)
+}
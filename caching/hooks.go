@@ -0,0 +1,196 @@
+package caching
+
+import (
+	"context"
+	"time"
+
+	tracer "github.com/BetaLixT/appInsightsTrace"
+)
+
+// Operation describes a cache call reported to hooks
+type Operation struct {
+	// CacheType is the backend, e.g. REDIS_CACHE_TYPE
+	CacheType string
+	// Name is the name given with WithName
+	Name string
+	// Command is the operation, e.g. "GET" or "MSET"
+	Command string
+	// Fields are extra properties such as the key or the pattern
+	Fields map[string]string
+}
+
+// Hook observes cache operations once they completed, implement it to trace
+// cache calls with any tracer (OpenTelemetry, App Insights, ...)
+type Hook interface {
+	AfterOperation(
+		ctx context.Context,
+		op Operation,
+		start_time time.Time,
+		end_time time.Time,
+		err error,
+	)
+}
+
+// HookFunc adapts a function to the Hook interface
+type HookFunc func(
+	ctx context.Context,
+	op Operation,
+	start_time time.Time,
+	end_time time.Time,
+	err error,
+)
+
+func (f HookFunc) AfterOperation(
+	ctx context.Context,
+	op Operation,
+	start_time time.Time,
+	end_time time.Time,
+	err error,
+) {
+	f(ctx, op, start_time, end_time, err)
+}
+
+type multiHook []Hook
+
+// MultiHook returns a hook that forwards every operation to all the given hooks in order
+// params:
+//   - hooks: hooks, nil hooks are skipped
+//
+// returns:
+//   - Hook: hook
+func MultiHook(hooks ...Hook) Hook {
+	m := make(multiHook, 0, len(hooks))
+	for _, h := range hooks {
+		if h != nil {
+			m = append(m, h)
+		}
+	}
+	return m
+}
+
+func (m multiHook) AfterOperation(
+	ctx context.Context,
+	op Operation,
+	start_time time.Time,
+	end_time time.Time,
+	err error,
+) {
+	for _, h := range m {
+		h.AfterOperation(ctx, op, start_time, end_time, err)
+	}
+}
+
+// Trx is the tracer interface shared with the sqldb package
+type Trx interface {
+	TraceDependency(
+		ctx context.Context,
+		spanId string,
+		dependencyType string,
+		serviceName string,
+		commandName string,
+		success bool,
+		startTimestamp time.Time,
+		eventTimestamp time.Time,
+		fields map[string]string,
+	)
+	TraceException(
+		ctx context.Context,
+		err interface{},
+		skip int,
+		fields map[string]string,
+	)
+}
+
+type trxHook struct {
+	t           Trx
+	serviceName string
+}
+
+// NewTrxHook returns a hook reporting every operation as a dependency, failures are
+// reported as exceptions as well
+// params:
+//   - t: tracer
+//   - serviceName: name of the service the dependencies belong to
+//
+// returns:
+//   - Hook: hook
+func NewTrxHook(t Trx, serviceName string) Hook {
+	return &trxHook{t: t, serviceName: serviceName}
+}
+
+// NewAppInsightsHook returns a hook tracing operations with App Insights
+// params:
+//   - t: App Insights tracer
+//
+// returns:
+//   - Hook: hook
+func NewAppInsightsHook(t *tracer.AppInsightsCore) Hook {
+	return NewTrxHook(t, t.ServName)
+}
+
+func (h *trxHook) AfterOperation(
+	ctx context.Context,
+	op Operation,
+	start_time time.Time,
+	end_time time.Time,
+	err error,
+) {
+	fields := make(map[string]string, len(op.Fields)+1)
+	for k, v := range op.Fields {
+		fields[k] = v
+	}
+	fields["cacheType"] = op.CacheType
+	if err != nil {
+		h.t.TraceException(ctx, err, 0, map[string]string{
+			"error":     "Error executing " + op.Command,
+			"message":   err.Error(),
+			"cacheType": op.CacheType,
+			"elasped":   end_time.Sub(start_time).String(),
+		})
+	}
+	h.t.TraceDependency(
+		ctx,
+		"000",
+		op.CacheType,
+		h.serviceName,
+		op.Command,
+		err == nil,
+		start_time,
+		end_time,
+		fields,
+	)
+}
+
+// WithHook returns a new instance of Cache reporting its operations to the hook
+// params:
+//   - h: hook, use MultiHook to attach several, nil disables tracing
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithHook(h Hook) Cache {
+	newC := c.clone()
+	newC.hook = h
+	newC.reportHealth()
+	return newC
+}
+
+// record updates the metrics and reports the operation to the hook
+func (c *cacheImpl) record(
+	ctx context.Context,
+	command string,
+	now time.Time,
+	end time.Time,
+	err error,
+	fields map[string]string,
+) {
+	c.metrics.observe(command, end.Sub(now), err)
+	if c.hook == nil {
+		return
+	}
+	c.hook.AfterOperation(ctx, Operation{
+		CacheType: c.typ,
+		Name:      c.name,
+		Command:   command,
+		Fields:    fields,
+	}, now, end, err)
+}
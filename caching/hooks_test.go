@@ -0,0 +1,135 @@
+package caching
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+type hookRecorder struct {
+	mtx  sync.Mutex
+	ops  []Operation
+	errs []error
+}
+
+func (r *hookRecorder) hook() Hook {
+	return HookFunc(func(ctx context.Context, op Operation, start, end time.Time, err error) {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		r.ops = append(r.ops, op)
+		r.errs = append(r.errs, err)
+	})
+}
+
+func (r *hookRecorder) commands() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	commands := make([]string, len(r.ops))
+	for i, op := range r.ops {
+		commands[i] = op.Command
+	}
+	return commands
+}
+
+type fakeTrx struct {
+	dependencies []string
+	success      []bool
+	fields       []map[string]string
+	exceptions   int
+}
+
+func (f *fakeTrx) TraceDependency(
+	ctx context.Context,
+	spanId string,
+	dependencyType string,
+	serviceName string,
+	commandName string,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) {
+	f.dependencies = append(f.dependencies, serviceName+"/"+dependencyType+"/"+commandName)
+	f.success = append(f.success, success)
+	f.fields = append(f.fields, fields)
+}
+
+func (f *fakeTrx) TraceException(
+	ctx context.Context,
+	err interface{},
+	skip int,
+	fields map[string]string,
+) {
+	f.exceptions++
+}
+
+func TestHookReceivesOperations(t *testing.T) {
+	ctx := context.Background()
+	rec := &hookRecorder{}
+	c := InitMemoryCache(time.Minute, time.Minute).WithName("hooks").WithHook(rec.hook())
+	assert.Nil(t, c.SetCtx(ctx, "key", "value"))
+	_, err := c.GetCtx(ctx, "key")
+	assert.Nil(t, err)
+	_, err = c.GetCtx(ctx, "missing")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	_, err = c.GetManyCtx(ctx, []string{"key"})
+	assert.Nil(t, err)
+	assert.Nil(t, c.DeleteCtx(ctx, "key"))
+
+	assert.Equal(t, []string{"SET", "GET", "GET", "MGET", "DEL"}, rec.commands())
+	assert.Equal(t, "hooks", rec.ops[0].Name)
+	assert.Equal(t, MEMORY_CACHE_TYPE, rec.ops[0].CacheType)
+	// traces carry the stored key, namespace included
+	assert.Equal(t, "hooks:key", rec.ops[0].Fields["key"])
+	assert.Equal(t, Err_KEY_NOT_FOUND, rec.errs[2])
+
+	// clones without the hook stay silent
+	assert.Nil(t, c.WithHook(nil).SetCtx(ctx, "key", "value"))
+	assert.Len(t, rec.commands(), 5)
+}
+
+func TestMultiHook(t *testing.T) {
+	first, second := &hookRecorder{}, &hookRecorder{}
+	c := InitMemoryCache(time.Minute, time.Minute).
+		WithHook(MultiHook(first.hook(), nil, second.hook()))
+	assert.Nil(t, c.Set("key", "value"))
+	assert.Equal(t, []string{"SET"}, first.commands())
+	assert.Equal(t, []string{"SET"}, second.commands())
+}
+
+func TestTrxHook(t *testing.T) {
+	ctx := context.Background()
+	trx := &fakeTrx{}
+	c := InitMemoryCache(time.Minute, time.Minute).WithHook(NewTrxHook(trx, "svc"))
+	assert.Nil(t, c.SetCtx(ctx, "key", "value"))
+	_, err := c.GetCtx(ctx, "missing")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{"svc/Memory/SET", "svc/Memory/GET"}, trx.dependencies)
+	assert.Equal(t, []bool{true, false}, trx.success)
+	assert.Equal(t, 1, trx.exceptions)
+	assert.Equal(t, MEMORY_CACHE_TYPE, trx.fields[0]["cacheType"])
+	assert.Equal(t, "key", trx.fields[0]["key"])
+}
+
+func TestHookReceivesFailedPings(t *testing.T) {
+	rec := &hookRecorder{}
+	c, err := InitRedisCacheWithOptions(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	})
+	assert.Nil(t, err)
+	defer c.Close()
+	c.WithHook(rec.hook()).WithHealthCheck(&HealthCheckOptions{
+		Interval: 10 * time.Millisecond,
+		Timeout:  50 * time.Millisecond,
+	})
+	assert.Eventually(t, func() bool {
+		commands := rec.commands()
+		return len(commands) > 0 && commands[0] == "PING"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,286 @@
+package caching
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const DEFAULT_INVALIDATION_CHANNEL = "stdlib:cache:invalidations"
+
+// InvalidationMessage is broadcast whenever a cache instance mutates keys
+// Origin identifies the publishing instance so it can ignore its own messages
+type InvalidationMessage struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+// InvalidationBus broadcasts key invalidations between cache instances
+// so replicas can drop stale entries from their memory stores
+// Subscribe returns a function that removes the handler again
+type InvalidationBus interface {
+	Publish(ctx context.Context, msg InvalidationMessage) error
+	Subscribe(handler func(msg InvalidationMessage)) (func(), error)
+	Close() error
+}
+
+// invalidationHandlers keeps the subscribed handlers by id so each one can be removed
+type invalidationHandlers struct {
+	handlers map[uint64]func(msg InvalidationMessage)
+	next     uint64
+	mtx      sync.RWMutex
+}
+
+func (h *invalidationHandlers) add(handler func(msg InvalidationMessage)) func() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.handlers == nil {
+		h.handlers = map[uint64]func(msg InvalidationMessage){}
+	}
+	id := h.next
+	h.next++
+	h.handlers[id] = handler
+	return func() {
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		delete(h.handlers, id)
+	}
+}
+
+func (h *invalidationHandlers) dispatch(msg InvalidationMessage) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	for _, handler := range h.handlers {
+		handler(msg)
+	}
+}
+
+func (h *invalidationHandlers) reset() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.handlers = nil
+}
+
+// len returns the number of subscribed handlers
+func (h *invalidationHandlers) len() int {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return len(h.handlers)
+}
+
+type redisInvalidationBus struct {
+	client     redis.UniversalClient
+	ownsClient bool
+	channel    string
+	pubsub     *redis.PubSub
+	handlers   invalidationHandlers
+	lgr        *zap.Logger
+}
+
+// NewRedisInvalidationBus initializes an invalidation bus over redis pub/sub
+// params:
+//   - url: redis url
+//   - channel: pub/sub channel, defaults to DEFAULT_INVALIDATION_CHANNEL when empty
+//
+// returns:
+//   - InvalidationBus: bus instance
+//   - error: error if any
+func NewRedisInvalidationBus(
+	url string,
+	channel string,
+) (InvalidationBus, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	// the client was created here, closing the bus closes it too
+	return newRedisInvalidationBus(redis.NewClient(opt), channel, true)
+}
+
+// NewRedisInvalidationBusWithClient initializes an invalidation bus over an existing redis client
+// the client is left open when the bus is closed
+// params:
+//   - client: a *redis.Client, *redis.ClusterClient or sentinel backed client
+//   - channel: pub/sub channel, defaults to DEFAULT_INVALIDATION_CHANNEL when empty
+//
+// returns:
+//   - InvalidationBus: bus instance
+//   - error: error if any
+func NewRedisInvalidationBusWithClient(
+	client redis.UniversalClient,
+	channel string,
+) (InvalidationBus, error) {
+	if client == nil {
+		return nil, Err_INVALID_REDIS_OPTIONS
+	}
+	return newRedisInvalidationBus(client, channel, false)
+}
+
+func newRedisInvalidationBus(
+	client redis.UniversalClient,
+	channel string,
+	ownsClient bool,
+) (InvalidationBus, error) {
+	if channel == "" {
+		channel = DEFAULT_INVALIDATION_CHANNEL
+	}
+	pubsub := client.Subscribe(context.Background(), channel)
+	// wait for the subscription to be confirmed before any message is published
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		pubsub.Close()
+		if ownsClient {
+			client.Close()
+		}
+		return nil, err
+	}
+	b := &redisInvalidationBus{
+		client:     client,
+		ownsClient: ownsClient,
+		channel:    channel,
+		pubsub:     pubsub,
+		lgr:        zap.NewNop(),
+	}
+	go b.listen()
+	return b, nil
+}
+
+func (b *redisInvalidationBus) listen() {
+	for m := range b.pubsub.Channel() {
+		var msg InvalidationMessage
+		if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+			b.lgr.Error("[Cache] Malformed invalidation message", zap.Error(err))
+			continue
+		}
+		b.handlers.dispatch(msg)
+	}
+}
+
+func (b *redisInvalidationBus) Publish(ctx context.Context, msg InvalidationMessage) error {
+	byts, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, byts).Err()
+}
+
+func (b *redisInvalidationBus) Subscribe(handler func(msg InvalidationMessage)) (func(), error) {
+	return b.handlers.add(handler), nil
+}
+
+func (b *redisInvalidationBus) Close() error {
+	b.handlers.reset()
+	if err := b.pubsub.Close(); err != nil {
+		return err
+	}
+	if !b.ownsClient {
+		return nil
+	}
+	return b.client.Close()
+}
+
+type localInvalidationBus struct {
+	handlers invalidationHandlers
+}
+
+// NewLocalInvalidationBus initializes an in-process invalidation bus
+// handlers are invoked synchronously on publish, useful for tests and single process setups
+//
+// returns:
+//   - InvalidationBus: bus instance
+func NewLocalInvalidationBus() InvalidationBus {
+	return &localInvalidationBus{}
+}
+
+func (b *localInvalidationBus) Publish(ctx context.Context, msg InvalidationMessage) error {
+	b.handlers.dispatch(msg)
+	return nil
+}
+
+func (b *localInvalidationBus) Subscribe(handler func(msg InvalidationMessage)) (func(), error) {
+	return b.handlers.add(handler), nil
+}
+
+func (b *localInvalidationBus) Close() error {
+	b.handlers.reset()
+	return nil
+}
+
+// WithInvalidationBus returns a new instance of Cache that publishes its writes on the bus
+// and drops keys invalidated by other instances from its memory store
+// the handler of a previously set bus is unsubscribed, Close unsubscribes the current one
+// params:
+//   - bus: invalidation bus, nil detaches the cache from its bus
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithInvalidationBus(bus InvalidationBus) Cache {
+	c.unsubscribeInvalidations()
+	newC := c.clone()
+	newC.bus = bus
+	newC.subscription = nil
+	if bus == nil || newC.mem == nil {
+		return newC
+	}
+	newC.origin = generateOrigin()
+	l1 := newC
+	origin := newC.origin
+	unsubscribe, err := bus.Subscribe(func(msg InvalidationMessage) {
+		if msg.Origin == origin {
+			return
+		}
+		for _, key := range msg.Keys {
+			l1.deleteMem(key)
+		}
+	})
+	if err != nil {
+		newC.lgr.Error("[Cache] Error subscribing to invalidations", zap.Error(err))
+		return newC
+	}
+	newC.subscription = &subscription{cancel: unsubscribe}
+	return newC
+}
+
+// subscription is shared by the copies of a cache so the handler is removed only once
+type subscription struct {
+	once   sync.Once
+	cancel func()
+}
+
+// unsubscribeInvalidations removes the invalidation handler of the cache, if any
+func (c *cacheImpl) unsubscribeInvalidations() {
+	if c.subscription == nil || c.subscription.cancel == nil {
+		return
+	}
+	c.subscription.once.Do(c.subscription.cancel)
+}
+
+// publishInvalidation notifies the other instances that the keys changed
+func (c *cacheImpl) publishInvalidation(ctx context.Context, keys ...string) {
+	if c.bus == nil || c.mem == nil || len(keys) == 0 {
+		return
+	}
+	err := c.bus.Publish(ctx, InvalidationMessage{
+		Origin: c.origin,
+		Keys:   keys,
+	})
+	if err != nil {
+		c.lgr.Error(
+			"[Cache] Error publishing invalidation",
+			zap.Strings("keys", keys),
+			zap.Error(err),
+		)
+	}
+}
+
+func generateOrigin() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,88 @@
+package caching
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidationDropsRemoteKeys(t *testing.T) {
+	bus := NewLocalInvalidationBus()
+	defer bus.Close()
+	a := InitMemoryCache(time.Minute, time.Minute).WithInvalidationBus(bus)
+	b := InitMemoryCache(time.Minute, time.Minute).WithInvalidationBus(bus)
+	assert.Nil(t, b.Set("test", "stale"))
+	assert.Nil(t, a.Set("test", "fresh"))
+	// the publishing instance keeps its own write
+	val, err := a.Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", val)
+	_, err = b.Get("test")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	assert.Nil(t, b.Set("other", "value"))
+	assert.Nil(t, a.Delete("other"))
+	_, err = b.Get("other")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+}
+
+func TestInvalidationSharedAcrossCopies(t *testing.T) {
+	bus := NewLocalInvalidationBus()
+	a := InitMemoryCache(time.Minute, time.Minute).WithInvalidationBus(bus)
+	b := InitMemoryCache(time.Minute, time.Minute).WithInvalidationBus(bus)
+	named := b.WithName("named")
+	assert.Nil(t, named.Set("test", "value"))
+	_, err := a.WithName("named").Get("test")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	// another copy of b in the same namespace still sees its own write
+	val, err := b.WithName("named").Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", val)
+}
+
+func TestRedisInvalidationBus(t *testing.T) {
+	redisUri := testRedisURI(t)
+	busA, err := NewRedisInvalidationBus(redisUri, "")
+	assert.Nil(t, err)
+	defer busA.Close()
+	busB, err := NewRedisInvalidationBus(redisUri, "")
+	assert.Nil(t, err)
+	defer busB.Close()
+	a, err := InitTwoTierCache(redisUri, nil)
+	assert.Nil(t, err)
+	a = a.WithInvalidationBus(busA)
+	b, err := InitTwoTierCache(redisUri, nil)
+	assert.Nil(t, err)
+	b = b.WithInvalidationBus(busB)
+	assert.Nil(t, b.SetWithExpiration("invalidation_test", "stale", time.Minute))
+	assert.Nil(t, a.SetWithExpiration("invalidation_test", "fresh", time.Minute))
+	assert.Eventually(t, func() bool {
+		_, found := b.(*cacheImpl).mem.Get("invalidation_test")
+		return !found
+	}, time.Second, 10*time.Millisecond)
+	val, err := b.Get("invalidation_test")
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", val)
+}
+
+func TestInvalidationUnsubscribesReplacedBus(t *testing.T) {
+	bus := NewLocalInvalidationBus()
+	handlers := &bus.(*localInvalidationBus).handlers
+	c := InitMemoryCache(time.Minute, time.Minute)
+	for i := 0; i < 5; i++ {
+		c = c.WithInvalidationBus(bus)
+	}
+	// every replacement drops the previous handler
+	assert.Equal(t, 1, handlers.len())
+
+	other := NewLocalInvalidationBus()
+	c = c.WithInvalidationBus(other)
+	assert.Equal(t, 0, handlers.len())
+	assert.Equal(t, 1, other.(*localInvalidationBus).handlers.len())
+
+	// copies share the subscription, closing any of them removes it once
+	named := c.WithName("named")
+	assert.Nil(t, named.Close())
+	assert.Nil(t, c.Close())
+	assert.Equal(t, 0, other.(*localInvalidationBus).handlers.len())
+}
@@ -0,0 +1,150 @@
+package caching
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+var (
+	Err_INVALID_ENCRYPTION_KEY = fmt.Errorf("encryption keys need a unique id of 1 to 255 bytes and a 16, 24 or 32 bytes secret")
+	Err_UNKNOWN_ENCRYPTION_KEY = fmt.Errorf("value was encrypted with a key missing from the keyring")
+	Err_DECRYPTION_FAILED      = fmt.Errorf("value could not be decrypted")
+)
+
+// EncryptionKey is an AES key, the ID is stored next to the ciphertext so values
+// written with a previous key can still be read after a rotation
+type EncryptionKey struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring holds the AES-GCM keys of an encrypted cache, the primary key encrypts
+// new values while every key of the ring decrypts
+type Keyring struct {
+	mtx     sync.RWMutex
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring initializes a keyring
+// params:
+//   - primary: key used to encrypt
+//   - previous: keys only used to decrypt values written before a rotation
+//
+// returns:
+//   - *Keyring: keyring instance
+//   - error: Err_INVALID_ENCRYPTION_KEY when a key is malformed or an id is reused
+func NewKeyring(primary EncryptionKey, previous ...EncryptionKey) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD, len(previous)+1)}
+	for _, key := range append([]EncryptionKey{primary}, previous...) {
+		if _, ok := k.aeads[key.ID]; ok {
+			return nil, Err_INVALID_ENCRYPTION_KEY
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[key.ID] = aead
+	}
+	k.primary = primary.ID
+	return k, nil
+}
+
+// Rotate makes key the primary key, the previous primary key is kept to decrypt
+// params:
+//   - key: new primary key, an existing id is promoted when the secret is empty
+//
+// returns:
+//   - error: Err_INVALID_ENCRYPTION_KEY when the key is malformed
+func (k *Keyring) Rotate(key EncryptionKey) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if _, ok := k.aeads[key.ID]; ok && len(key.Secret) == 0 {
+		k.primary = key.ID
+		return nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	k.aeads[key.ID] = aead
+	k.primary = key.ID
+	return nil
+}
+
+// Retire removes a key once no value encrypted with it is left
+// params:
+//   - id: id of the key
+//
+// returns:
+//   - error: Err_INVALID_ENCRYPTION_KEY when id is the primary key
+func (k *Keyring) Retire(id string) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if id == k.primary {
+		return Err_INVALID_ENCRYPTION_KEY
+	}
+	delete(k.aeads, id)
+	return nil
+}
+
+func newAEAD(key EncryptionKey) (cipher.AEAD, error) {
+	if len(key.ID) == 0 || len(key.ID) > 255 {
+		return nil, Err_INVALID_ENCRYPTION_KEY
+	}
+	switch len(key.Secret) {
+	case 16, 24, 32:
+	default:
+		return nil, Err_INVALID_ENCRYPTION_KEY
+	}
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data with the primary key, the result is
+// [id length][id][nonce][ciphertext], ad is authenticated with the value
+// so it only opens with the same ad
+func (k *Keyring) seal(data []byte, ad []byte) ([]byte, error) {
+	k.mtx.RLock()
+	id := k.primary
+	aead := k.aeads[id]
+	k.mtx.RUnlock()
+	out := make([]byte, 0, 1+len(id)+aead.NonceSize()+len(data)+aead.Overhead())
+	out = append(out, byte(len(id)))
+	out = append(out, id...)
+	nonce := out[len(out) : len(out)+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = out[:len(out)+aead.NonceSize()]
+	return aead.Seal(out, nonce, data, ad), nil
+}
+
+// open decrypts data written by seal with whichever key of the ring encrypted it
+func (k *Keyring) open(data []byte, ad []byte) ([]byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, Err_DECRYPTION_FAILED
+	}
+	id := string(data[1 : 1+data[0]])
+	data = data[1+data[0]:]
+	k.mtx.RLock()
+	aead, ok := k.aeads[id]
+	k.mtx.RUnlock()
+	if !ok {
+		return nil, Err_UNKNOWN_ENCRYPTION_KEY
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, Err_DECRYPTION_FAILED
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, Err_DECRYPTION_FAILED
+	}
+	return plain, nil
+}
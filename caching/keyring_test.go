@@ -0,0 +1,56 @@
+package caching
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeyringValidatesKeys(t *testing.T) {
+	_, err := NewKeyring(EncryptionKey{ID: "k1", Secret: []byte("short")})
+	assert.Equal(t, Err_INVALID_ENCRYPTION_KEY, err)
+	_, err = NewKeyring(EncryptionKey{Secret: bytes.Repeat([]byte{1}, 16)})
+	assert.Equal(t, Err_INVALID_ENCRYPTION_KEY, err)
+	_, err = NewKeyring(
+		EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{1}, 16)},
+		EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{2}, 24)},
+	)
+	assert.Equal(t, Err_INVALID_ENCRYPTION_KEY, err)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	k, err := NewKeyring(EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	assert.Nil(t, err)
+	old, err := k.seal([]byte("value"), []byte("key"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, k.Rotate(EncryptionKey{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)}))
+	current, err := k.seal([]byte("value"), []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "k2", string(current[1:1+current[0]]))
+
+	// values sealed with the previous key still open
+	plain, err := k.open(old, []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), plain)
+
+	assert.Equal(t, Err_INVALID_ENCRYPTION_KEY, k.Retire("k2"))
+	assert.Nil(t, k.Retire("k1"))
+	_, err = k.open(old, []byte("key"))
+	assert.Equal(t, Err_UNKNOWN_ENCRYPTION_KEY, err)
+
+	// a known key can be promoted back without its secret
+	assert.Nil(t, k.Rotate(EncryptionKey{ID: "k2"}))
+	assert.Equal(t, Err_INVALID_ENCRYPTION_KEY, k.Rotate(EncryptionKey{ID: "k3"}))
+
+	tampered := append([]byte{}, current...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = k.open(tampered, []byte("key"))
+	assert.Equal(t, Err_DECRYPTION_FAILED, err)
+	_, err = k.open([]byte{9, 'k'}, []byte("key"))
+	assert.Equal(t, Err_DECRYPTION_FAILED, err)
+	// the additional data must match
+	_, err = k.open(current, []byte("other"))
+	assert.Equal(t, Err_DECRYPTION_FAILED, err)
+}
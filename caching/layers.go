@@ -0,0 +1,247 @@
+package caching
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var Err_CORRUPTED_VALUE = fmt.Errorf("value has an unknown or corrupted layer header")
+
+// layer_magic starts every value written through a layer, plain text and json never
+// start with a NUL byte so values written without layers are read as they are
+const layer_magic = "\x00\xc5"
+
+const (
+	plain_layer      byte = 'p'
+	gzip_layer       byte = 'g'
+	zstd_layer       byte = 'z'
+	encryption_layer byte = 'e'
+)
+
+const default_compression_threshold = 1024
+
+// CompressionAlgorithm is the algorithm used to compress values
+type CompressionAlgorithm string
+
+const (
+	GZIP_COMPRESSION CompressionAlgorithm = "gzip"
+	ZSTD_COMPRESSION CompressionAlgorithm = "zstd"
+)
+
+// CompressionOptions configures the compression layer
+// params:
+//   - Algorithm: GZIP_COMPRESSION or ZSTD_COMPRESSION, defaults to gzip
+//   - Threshold: values smaller than this many bytes are stored as they are, defaults to 1KiB
+type CompressionOptions struct {
+	Algorithm CompressionAlgorithm
+	Threshold int
+}
+
+// valueLayers transforms values on their way to and from the backend,
+// values are compressed first and then encrypted
+type valueLayers struct {
+	compression *CompressionOptions
+	keyring     *Keyring
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// zstdCodecs lazily creates the shared zstd encoder and decoder, both are safe for concurrent use
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// WithCompression returns a new instance of Cache that compresses values above a size threshold,
+// values must be encodable by redis, reads detect compressed values whatever the options
+// params:
+//   - opts: compression options, defaults are used when nil
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithCompression(opts *CompressionOptions) Cache {
+	if opts == nil {
+		opts = &CompressionOptions{}
+	}
+	compression := *opts
+	if compression.Algorithm != ZSTD_COMPRESSION {
+		compression.Algorithm = GZIP_COMPRESSION
+	}
+	if compression.Threshold <= 0 {
+		compression.Threshold = default_compression_threshold
+	}
+	newC := c.clone()
+	newC.layers = &valueLayers{compression: &compression}
+	if c.layers != nil {
+		newC.layers.keyring = c.layers.keyring
+	}
+	return newC
+}
+
+// WithEncryption returns a new instance of Cache that encrypts values with AES-GCM,
+// values must be encodable by redis and come back as they would from redis
+// params:
+//   - k: keyring, nil disables encryption
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithEncryption(k *Keyring) Cache {
+	newC := c.clone()
+	newC.layers = &valueLayers{keyring: k}
+	if c.layers != nil {
+		newC.layers.compression = c.layers.compression
+	}
+	if newC.layers.compression == nil && k == nil {
+		newC.layers = nil
+	}
+	return newC
+}
+
+// encode applies the layers of the cache to a value about to be stored at key,
+// encrypted values are bound to the stored key so they can't be moved to another one
+func (c *cacheImpl) encode(key string, value interface{}) (interface{}, error) {
+	if c.layers == nil {
+		return value, nil
+	}
+	data, err := encodeDiskValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if opts := c.layers.compression; opts != nil && len(data) >= opts.Threshold {
+		if data, err = compress(opts.Algorithm, data); err != nil {
+			return nil, err
+		}
+	} else if bytes.HasPrefix(data, []byte(layer_magic)) {
+		// a plain value that happens to start like a layer header is marked as plain
+		data = append([]byte(layer_magic+string(plain_layer)), data...)
+	}
+	if c.layers.keyring != nil {
+		sealed, err := c.layers.keyring.seal(data, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		data = append([]byte(layer_magic+string(encryption_layer)), sealed...)
+	}
+	return data, nil
+}
+
+// decode peels the layers off a value stored at key, the value keeps the type
+// the backend returned it with
+func (c *cacheImpl) decode(key string, raw interface{}) (interface{}, error) {
+	if c.layers == nil {
+		return raw, nil
+	}
+	var data []byte
+	switch v := raw.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return raw, nil
+	}
+	if !bytes.HasPrefix(data, []byte(layer_magic)) {
+		return raw, nil
+	}
+	data, err := c.layers.peel(key, data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := raw.(string); ok {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+// peel removes layer headers until the plain value is reached, compression is the
+// innermost layer so a decompressed value is returned as it is even when it starts
+// like a layer header
+func (l *valueLayers) peel(key string, data []byte) ([]byte, error) {
+	var err error
+	for bytes.HasPrefix(data, []byte(layer_magic)) {
+		if len(data) <= len(layer_magic) {
+			return nil, Err_CORRUPTED_VALUE
+		}
+		layer, body := data[len(layer_magic)], data[len(layer_magic)+1:]
+		switch layer {
+		case plain_layer:
+			return body, nil
+		case gzip_layer:
+			var r *gzip.Reader
+			if r, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+				return nil, Err_CORRUPTED_VALUE
+			}
+			if data, err = io.ReadAll(r); err != nil {
+				return nil, Err_CORRUPTED_VALUE
+			}
+			return data, nil
+		case zstd_layer:
+			_, dec := zstdCodecs()
+			if data, err = dec.DecodeAll(body, nil); err != nil {
+				return nil, Err_CORRUPTED_VALUE
+			}
+			return data, nil
+		case encryption_layer:
+			if l.keyring == nil {
+				return nil, Err_UNKNOWN_ENCRYPTION_KEY
+			}
+			if data, err = l.keyring.open(body, []byte(key)); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, Err_CORRUPTED_VALUE
+		}
+	}
+	return data, nil
+}
+
+func compress(algorithm CompressionAlgorithm, data []byte) ([]byte, error) {
+	if algorithm == ZSTD_COMPRESSION {
+		enc, _ := zstdCodecs()
+		return enc.EncodeAll(data, []byte(layer_magic+string(zstd_layer))), nil
+	}
+	buf := bytes.NewBufferString(layer_magic + string(gzip_layer))
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compareAndSwapLayered resolves the stored form of old for caches with layers,
+// encrypted values never compare equal byte for byte so the current value is read,
+// decoded and compared, the swap then only succeeds if the stored bytes did not change
+func (c *cacheImpl) compareAndSwapLayered(
+	ctx context.Context,
+	key string,
+	old interface{},
+) (interface{}, bool, error) {
+	raw, err := c.fetch(ctx, key)
+	if isMiss(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	current, err := c.decode(key, raw)
+	if err != nil {
+		return nil, false, err
+	}
+	return raw, sameValue(current, old), nil
+}
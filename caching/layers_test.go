@@ -0,0 +1,196 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	k, err := NewKeyring(EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	assert.Nil(t, err)
+	return k
+}
+
+func testLayers(t *testing.T, c Cache, prefix string) {
+	ctx := context.Background()
+	k := testKeyring(t)
+	large := strings.Repeat(`{"name":"payload"}`, 200)
+	plain := c.WithName(prefix + "layers")
+	for _, tc := range []struct {
+		layered    Cache
+		compressed bool
+	}{
+		{plain.WithCompression(&CompressionOptions{Threshold: 100}), true},
+		{plain.WithCompression(&CompressionOptions{Algorithm: ZSTD_COMPRESSION, Threshold: 100}), true},
+		{plain.WithEncryption(k), false},
+		{plain.WithCompression(nil).WithEncryption(k), true},
+		{plain.WithEncryption(k).WithCompression(&CompressionOptions{Algorithm: ZSTD_COMPRESSION}), true},
+	} {
+		layered := tc.layered
+		assert.Nil(t, layered.SetCtx(ctx, "large", large))
+		assert.Nil(t, layered.SetWithExpirationCtx(ctx, "small", "tiny", time.Minute))
+		v, err := layered.GetCtx(ctx, "large")
+		assert.Nil(t, err)
+		assert.Equal(t, large, toString(v))
+		v, err = layered.GetCtx(ctx, "small")
+		assert.Nil(t, err)
+		assert.Equal(t, "tiny", toString(v))
+
+		// the backend only sees the stored form
+		raw, err := plain.GetCtx(ctx, "large")
+		assert.Nil(t, err)
+		assert.NotEqual(t, large, toString(raw))
+		if tc.compressed {
+			assert.Less(t, len(toString(raw)), len(large))
+		}
+		assert.True(t, strings.HasPrefix(toString(raw), layer_magic))
+
+		assert.Nil(t, layered.SetManyCtx(ctx, map[string]interface{}{"a": large, "b": 7}, time.Minute))
+		res, err := layered.GetManyCtx(ctx, []string{"a", "b", "c"})
+		assert.Nil(t, err)
+		assert.Equal(t, large, toString(res.Found["a"]))
+		assert.Equal(t, "7", toString(res.Found["b"]))
+		assert.Equal(t, []string{"c"}, res.Missing)
+
+		ok, err := layered.CompareAndSwapCtx(ctx, "b", 7, 8, time.Minute)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = layered.CompareAndSwapCtx(ctx, "b", 7, 9, time.Minute)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		v, err = layered.GetCtx(ctx, "b")
+		assert.Nil(t, err)
+		assert.Equal(t, "8", toString(v))
+
+		ok, err = layered.SetIfAbsentCtx(ctx, "b", large, time.Minute)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		_, err = plain.DeletePatternCtx(ctx, "*")
+		assert.Nil(t, err)
+	}
+
+	// values written before the layers were enabled are still readable
+	assert.Nil(t, plain.SetCtx(ctx, "legacy", "plain"))
+	v, err := plain.WithEncryption(k).GetCtx(ctx, "legacy")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", toString(v))
+	_, err = plain.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+}
+
+func TestLayersPlainValueLookingLikeAHeader(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute).WithEncryption(testKeyring(t))
+	tricky := []byte(layer_magic + "gnot gzip")
+	assert.Nil(t, c.SetCtx(ctx, "tricky", tricky))
+	v, err := c.GetCtx(ctx, "tricky")
+	assert.Nil(t, err)
+	assert.Equal(t, tricky, v)
+}
+
+func TestLayersCompressedValueLookingLikeAHeader(t *testing.T) {
+	ctx := context.Background()
+	tricky := layer_magic + "g" + strings.Repeat("x", 200)
+	for _, algorithm := range []CompressionAlgorithm{GZIP_COMPRESSION, ZSTD_COMPRESSION} {
+		c := InitMemoryCache(time.Minute, time.Minute).
+			WithCompression(&CompressionOptions{Algorithm: algorithm, Threshold: 100})
+		assert.Nil(t, c.SetCtx(ctx, "tricky", tricky))
+		v, err := c.GetCtx(ctx, "tricky")
+		assert.Nil(t, err)
+		assert.Equal(t, tricky, toString(v))
+	}
+}
+
+func TestLayersEncryptionBoundToKey(t *testing.T) {
+	ctx := context.Background()
+	plain := InitMemoryCache(time.Minute, time.Minute)
+	k := testKeyring(t)
+	c := plain.WithEncryption(k)
+	assert.Nil(t, c.SetCtx(ctx, "alice", "pii"))
+	sealed, err := plain.GetCtx(ctx, "alice")
+	assert.Nil(t, err)
+
+	// a sealed value copied to another key does not open
+	assert.Nil(t, plain.SetCtx(ctx, "mallory", sealed))
+	_, err = c.GetCtx(ctx, "mallory")
+	assert.Equal(t, Err_DECRYPTION_FAILED, err)
+	// nor under another namespace
+	assert.Nil(t, plain.WithName("tenant").SetCtx(ctx, "alice", sealed))
+	_, err = c.WithName("tenant").GetCtx(ctx, "alice")
+	assert.Equal(t, Err_DECRYPTION_FAILED, err)
+
+	v, err := c.GetCtx(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, "pii", toString(v))
+}
+
+func TestLayersCorruptedValue(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.SetCtx(ctx, "broken", []byte(layer_magic+"gnot gzip")))
+	_, err := c.WithCompression(nil).GetCtx(ctx, "broken")
+	assert.Equal(t, Err_CORRUPTED_VALUE, err)
+
+	// encrypted values can't be read without the keyring
+	assert.Nil(t, c.WithEncryption(testKeyring(t)).SetCtx(ctx, "secret", "pii"))
+	_, err = c.WithCompression(nil).GetCtx(ctx, "secret")
+	assert.Equal(t, Err_UNKNOWN_ENCRYPTION_KEY, err)
+	raw, err := c.GetCtx(ctx, "secret")
+	assert.Nil(t, err)
+	assert.NotContains(t, toString(raw), "pii")
+}
+
+func TestLayersExportImport(t *testing.T) {
+	ctx := context.Background()
+	k := testKeyring(t)
+	redisCache, err := InitRedisCache(testRedisURI(t))
+	assert.Nil(t, err)
+	defer redisCache.Close()
+	large := strings.Repeat("pii", 100)
+	for _, backend := range []Cache{InitMemoryCache(time.Minute, time.Minute), redisCache} {
+		src := backend.WithName("export_src").
+			WithCompression(&CompressionOptions{Threshold: 100}).WithEncryption(k)
+		assert.Nil(t, src.SetCtx(ctx, "secret", "pii"))
+		assert.Nil(t, src.SetCtx(ctx, "large", large))
+		buf := &bytes.Buffer{}
+		n, err := src.Export(ctx, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+
+		// the values are sealed again under their new keys
+		dst := backend.WithName("export_dst").WithVersion(2).WithEncryption(k)
+		n, err = dst.Import(ctx, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+		v, err := dst.GetCtx(ctx, "secret")
+		assert.Nil(t, err)
+		assert.Equal(t, "pii", toString(v))
+		v, err = dst.GetCtx(ctx, "large")
+		assert.Nil(t, err)
+		assert.Equal(t, large, toString(v))
+		raw, err := backend.WithName("export_dst").WithVersion(2).GetCtx(ctx, "secret")
+		assert.Nil(t, err)
+		assert.NotContains(t, toString(raw), "pii")
+
+		_, err = backend.WithName("export_src").DeletePatternCtx(ctx, "*")
+		assert.Nil(t, err)
+		_, err = backend.WithName("export_dst").DeletePatternCtx(ctx, "*")
+		assert.Nil(t, err)
+	}
+}
+
+func TestLayersStore(t *testing.T) {
+	type user struct{ Name string }
+	s := NewStore[user](InitMemoryCache(time.Minute, time.Minute).
+		WithCompression(&CompressionOptions{Threshold: 1}).
+		WithEncryption(testKeyring(t)), MsgpackCodec)
+	assert.Nil(t, s.Set("u", user{Name: "jane"}))
+	u, err := s.Get("u")
+	assert.Nil(t, err)
+	assert.Equal(t, "jane", u.Name)
+}
@@ -0,0 +1,160 @@
+package caching
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const load_lock_prefix = "lock:load:"
+
+// LoaderFn computes the value of a key on a cache miss
+type LoaderFn func(ctx context.Context) (interface{}, error)
+
+// LoadLockOptions configures the distributed lock taken by GetOrLoad on redis backed caches
+// params:
+//   - LockTTL: how long the lock is held at most, defaults to 10 seconds
+//   - WaitTimeout: how long a replica waits for the lock holder to fill the key
+//     before loading it itself, defaults to LockTTL
+//   - RetryInterval: how often a waiting replica checks the cache, defaults to 50ms
+type LoadLockOptions struct {
+	LockTTL       time.Duration
+	WaitTimeout   time.Duration
+	RetryInterval time.Duration
+}
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// WithLoadLock returns a new instance of Cache that takes a redis lock in GetOrLoad
+// so only one replica recomputes a missing key, it has no effect on memory caches
+// params:
+//   - opts: lock options, defaults are used when nil
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithLoadLock(opts *LoadLockOptions) Cache {
+	if opts == nil {
+		opts = &LoadLockOptions{}
+	}
+	lockOpts := *opts
+	if lockOpts.LockTTL <= 0 {
+		lockOpts.LockTTL = 10 * time.Second
+	}
+	if lockOpts.WaitTimeout <= 0 {
+		lockOpts.WaitTimeout = lockOpts.LockTTL
+	}
+	if lockOpts.RetryInterval <= 0 {
+		lockOpts.RetryInterval = 50 * time.Millisecond
+	}
+	newC := c.clone()
+	newC.loadLock = &lockOpts
+	return newC
+}
+
+// GetOrLoad returns the value for the given key, calling the loader on a miss
+// concurrent misses for the same key share a single loader call
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - ttl:time.Duration => expiration of the loaded value, 0 keeps the backend default
+//   - loader:LoaderFn => function computing the value
+//
+// returns:
+//   - interface{}: value
+//   - error: error if any
+func (c *cacheImpl) GetOrLoad(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	loader LoaderFn,
+) (interface{}, error) {
+	v, err := c.GetCtx(ctx, key)
+	if err == nil {
+		return v, nil
+	}
+	if !isMiss(err) && err != Err_CACHE_UNAVAILABLE {
+		c.lgr.Warn("[Cache] Loading through cache failure", zap.String("key", key), zap.Error(err))
+	}
+	v, err, _ = c.flights.Do(c.key(key), func() (interface{}, error) {
+		if c.loadLock != nil && c.redis != nil && c.available() == nil {
+			return c.loadWithLock(ctx, key, ttl, loader)
+		}
+		return c.load(ctx, key, ttl, loader)
+	})
+	return v, err
+}
+
+// load calls the loader and stores its result
+func (c *cacheImpl) load(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	loader LoaderFn,
+) (interface{}, error) {
+	v, err := loader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		err = c.SetWithExpirationCtx(ctx, key, v, ttl)
+	} else {
+		err = c.SetCtx(ctx, key, v)
+	}
+	if err != nil && err != Err_CACHE_UNAVAILABLE {
+		c.lgr.Warn("[Cache] Error storing loaded value", zap.String("key", key), zap.Error(err))
+	}
+	return v, nil
+}
+
+// loadWithLock loads the key while holding a redis lock, replicas that fail to
+// take the lock wait for the holder to fill the key
+func (c *cacheImpl) loadWithLock(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	loader LoaderFn,
+) (interface{}, error) {
+	lockKey := load_lock_prefix + c.key(key)
+	token := generateOrigin()
+	acquired, err := c.redis.SetNX(ctx, lockKey, token, c.loadLock.LockTTL).Result()
+	if err != nil {
+		c.lgr.Warn("[Cache] Error acquiring load lock", zap.String("key", key), zap.Error(err))
+		return c.load(ctx, key, ttl, loader)
+	}
+	if acquired {
+		defer func() {
+			if err := releaseLockScript.Run(ctx, c.redis, []string{lockKey}, token).Err(); err != nil {
+				c.lgr.Warn("[Cache] Error releasing load lock", zap.String("key", key), zap.Error(err))
+			}
+		}()
+		return c.load(ctx, key, ttl, loader)
+	}
+	deadline := time.NewTimer(c.loadLock.WaitTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(c.loadLock.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return c.load(ctx, key, ttl, loader)
+		case <-ticker.C:
+			if v, err := c.GetCtx(ctx, key); err == nil {
+				return v, nil
+			}
+		}
+	}
+}
+
+// isMiss reports whether the error returned by a backend means the key does not exist
+func isMiss(err error) bool {
+	return err == Err_KEY_NOT_FOUND || err == redis.Nil
+}
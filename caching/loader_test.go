@@ -0,0 +1,92 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrLoadCollapsesMisses(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute)
+	var calls int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "loaded", nil
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := c.GetOrLoad(context.Background(), "test", time.Minute, loader)
+			assert.Nil(t, err)
+			assert.Equal(t, "loaded", val)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	val, err := c.Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded", val)
+}
+
+func TestGetOrLoadHit(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.Set("test", "cached"))
+	val, err := c.GetOrLoad(context.Background(), "test", time.Minute,
+		func(ctx context.Context) (interface{}, error) {
+			t.Fatal("loader should not be called on a hit")
+			return nil, nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "cached", val)
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute)
+	loadErr := errors.New("boom")
+	_, err := c.GetOrLoad(context.Background(), "test", time.Minute,
+		func(ctx context.Context) (interface{}, error) {
+			return nil, loadErr
+		})
+	assert.Equal(t, loadErr, err)
+	_, err = c.Get("test")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+}
+
+func TestGetOrLoadWithRedisLock(t *testing.T) {
+	redisUri := testRedisURI(t)
+	// two caches stand in for two replicas, each with its own singleflight group
+	a, err := InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	b, err := InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	opts := &LoadLockOptions{LockTTL: 5 * time.Second, RetryInterval: 10 * time.Millisecond}
+	a = a.WithLoadLock(opts)
+	b = b.WithLoadLock(opts)
+	assert.Nil(t, a.Delete("load_lock_test"))
+	var calls int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return "loaded", nil
+	}
+	wg := sync.WaitGroup{}
+	for _, c := range []Cache{a, b} {
+		wg.Add(1)
+		go func(c Cache) {
+			defer wg.Done()
+			val, err := c.GetOrLoad(context.Background(), "load_lock_test", time.Minute, loader)
+			assert.Nil(t, err)
+			assert.Equal(t, "loaded", val)
+		}(c)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
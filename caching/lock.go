@@ -0,0 +1,457 @@
+package caching
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	Err_LOCK_NOT_ACQUIRED   = fmt.Errorf("lock not acquired")
+	Err_LOCK_NOT_HELD       = fmt.Errorf("lock not held")
+	Err_UNSUPPORTED_LOCKER  = fmt.Errorf("locks need a redis, two tier or memory cache")
+	Err_INVALID_LOCK_TTL    = fmt.Errorf("lock ttl must be positive")
+	Err_INVALID_LOCK_CLIENT = fmt.Errorf("redis client is nil")
+)
+
+// LockerOptions configures a Locker
+// params:
+//   - RetryInterval: how often Acquire tries again while the lock is taken, defaults to 50ms
+//   - ExtendInterval: how often held locks extend their lease, defaults to a third of the ttl,
+//     a negative interval disables automatic extension
+type LockerOptions struct {
+	RetryInterval  time.Duration
+	ExtendInterval time.Duration
+}
+
+// Locker hands out exclusive locks on keys
+type Locker interface {
+	// Acquire waits until the lock is free or the context is done
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+	// TryAcquire returns Err_LOCK_NOT_ACQUIRED right away when the lock is taken
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a held lock, its lease is extended in the background until it is released
+type Lock interface {
+	Key() string
+	// Token is a fencing token, it grows every time the key is locked so storage
+	// can reject writes coming from an older holder
+	Token() int64
+	// Extend resets the lease to ttl, it returns Err_LOCK_NOT_HELD when the lease was lost
+	Extend(ctx context.Context, ttl time.Duration) error
+	// Release frees the lock, it returns Err_LOCK_NOT_HELD when the lease was lost
+	Release(ctx context.Context) error
+	// Lost is closed when the lease could not be extended before it expired
+	Lost() <-chan struct{}
+}
+
+// lockBackend stores the leases, owner identifies the holder
+type lockBackend interface {
+	acquire(ctx context.Context, key string, owner string, ttl time.Duration) (int64, bool, error)
+	extend(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, key string, owner string) (bool, error)
+}
+
+// NewLocker returns a locker sharing the connection of the cache, redis and two tier
+// caches lock in redis while memory caches lock within the process, lockers of the
+// same memory cache share their locks, keys are locked within the name and version
+// of the cache
+// params:
+//   - c: cache
+//   - opts: locker options, defaults are used when nil
+//
+// returns:
+//   - Locker: locker
+//   - error: Err_UNSUPPORTED_LOCKER for other caches
+func NewLocker(c Cache, opts *LockerOptions) (Locker, error) {
+	impl, ok := c.(*cacheImpl)
+	if !ok {
+		return nil, Err_UNSUPPORTED_LOCKER
+	}
+	switch impl.typ {
+	case REDIS_CACHE_TYPE, TWO_TIER_CACHE_TYPE:
+		if impl.redis == nil {
+			return nil, Err_INVALID_LOCK_CLIENT
+		}
+		return newLocker(prefixLockBackend(&redisLockBackend{client: impl.redis}, impl.prefix), opts), nil
+	case MEMORY_CACHE_TYPE:
+		return newLocker(prefixLockBackend(impl.locks, impl.prefix), opts), nil
+	}
+	return nil, Err_UNSUPPORTED_LOCKER
+}
+
+// prefixedLockBackend locks keys under the namespace of a cache
+type prefixedLockBackend struct {
+	backend lockBackend
+	prefix  string
+}
+
+func prefixLockBackend(backend lockBackend, prefix string) lockBackend {
+	if prefix == "" {
+		return backend
+	}
+	return &prefixedLockBackend{backend: backend, prefix: prefix}
+}
+
+func (b *prefixedLockBackend) acquire(
+	ctx context.Context,
+	key string,
+	owner string,
+	ttl time.Duration,
+) (int64, bool, error) {
+	return b.backend.acquire(ctx, b.prefix+key, owner, ttl)
+}
+
+func (b *prefixedLockBackend) extend(
+	ctx context.Context,
+	key string,
+	owner string,
+	ttl time.Duration,
+) (bool, error) {
+	return b.backend.extend(ctx, b.prefix+key, owner, ttl)
+}
+
+func (b *prefixedLockBackend) release(ctx context.Context, key string, owner string) (bool, error) {
+	return b.backend.release(ctx, b.prefix+key, owner)
+}
+
+// NewRedisLocker returns a locker storing its leases in redis
+// params:
+//   - client: redis client, cluster clients are supported
+//   - opts: locker options, defaults are used when nil
+//
+// returns:
+//   - Locker: locker
+//   - error: error if any
+func NewRedisLocker(client redis.UniversalClient, opts *LockerOptions) (Locker, error) {
+	if client == nil {
+		return nil, Err_INVALID_LOCK_CLIENT
+	}
+	return newLocker(&redisLockBackend{client: client}, opts), nil
+}
+
+// NewMemoryLocker returns a locker for a single process, meant for tests and local runs
+// params:
+//   - opts: locker options, defaults are used when nil
+//
+// returns:
+//   - Locker: locker
+func NewMemoryLocker(opts *LockerOptions) Locker {
+	return newLocker(newMemoryLockBackend(), opts)
+}
+
+type locker struct {
+	backend lockBackend
+	opts    LockerOptions
+}
+
+func newLocker(backend lockBackend, opts *LockerOptions) *locker {
+	cfg := LockerOptions{}
+	if opts != nil {
+		cfg = *opts
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 50 * time.Millisecond
+	}
+	return &locker{backend: backend, opts: cfg}
+}
+
+func (l *locker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	if ttl <= 0 {
+		return nil, Err_INVALID_LOCK_TTL
+	}
+	owner, err := generateLockOwner()
+	if err != nil {
+		return nil, err
+	}
+	token, ok, err := l.backend.acquire(ctx, key, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, Err_LOCK_NOT_ACQUIRED
+	}
+	return l.newLock(key, owner, token, ttl), nil
+}
+
+func (l *locker) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	ticker := time.NewTicker(l.opts.RetryInterval)
+	defer ticker.Stop()
+	for {
+		lock, err := l.TryAcquire(ctx, key, ttl)
+		if err != Err_LOCK_NOT_ACQUIRED {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *locker) newLock(key string, owner string, token int64, ttl time.Duration) *heldLock {
+	lock := &heldLock{
+		backend:  l.backend,
+		key:      key,
+		owner:    owner,
+		token:    token,
+		ttl:      ttl,
+		deadline: time.Now().Add(ttl),
+		lost:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	interval := l.opts.ExtendInterval
+	if interval == 0 {
+		interval = ttl / 3
+	}
+	if interval > 0 {
+		go lock.keepAlive(interval)
+	} else {
+		close(lock.done)
+	}
+	return lock
+}
+
+type heldLock struct {
+	backend  lockBackend
+	key      string
+	owner    string
+	token    int64
+	mtx      sync.Mutex
+	ttl      time.Duration
+	deadline time.Time
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func (l *heldLock) Key() string {
+	return l.key
+}
+
+func (l *heldLock) Token() int64 {
+	return l.token
+}
+
+func (l *heldLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *heldLock) Extend(ctx context.Context, ttl time.Duration) error {
+	if ttl <= 0 {
+		return Err_INVALID_LOCK_TTL
+	}
+	start := time.Now()
+	ok, err := l.backend.extend(ctx, l.key, l.owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.markLost()
+		return Err_LOCK_NOT_HELD
+	}
+	l.mtx.Lock()
+	l.ttl, l.deadline = ttl, start.Add(ttl)
+	l.mtx.Unlock()
+	return nil
+}
+
+func (l *heldLock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.done
+	ok, err := l.backend.release(ctx, l.key, l.owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.markLost()
+		return Err_LOCK_NOT_HELD
+	}
+	return nil
+}
+
+func (l *heldLock) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
+
+// keepAlive extends the lease until the lock is released, transient errors are
+// retried until the lease runs out
+func (l *heldLock) keepAlive(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-l.lost:
+			return
+		case <-ticker.C:
+		}
+		l.mtx.Lock()
+		ttl, deadline := l.ttl, l.deadline
+		l.mtx.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := l.Extend(ctx, ttl)
+		cancel()
+		if err != nil && time.Now().After(deadline) {
+			l.markLost()
+		}
+	}
+}
+
+func generateLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ===============================================================================	Redis	Lock	=========================================================================
+// the lease and the fencing counter share a hash tag so the scripts work on clusters
+var acquireLockScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+var extendLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+type redisLockBackend struct {
+	client redis.UniversalClient
+}
+
+func redisLockKeys(key string) (string, string) {
+	return "lock:{" + key + "}", "lock:{" + key + "}:fence"
+}
+
+func (b *redisLockBackend) acquire(
+	ctx context.Context,
+	key string,
+	owner string,
+	ttl time.Duration,
+) (int64, bool, error) {
+	lease, fence := redisLockKeys(key)
+	token, err := acquireLockScript.Run(
+		ctx,
+		b.client,
+		[]string{lease, fence},
+		owner,
+		ttl.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token > 0, nil
+}
+
+func (b *redisLockBackend) extend(
+	ctx context.Context,
+	key string,
+	owner string,
+	ttl time.Duration,
+) (bool, error) {
+	lease, _ := redisLockKeys(key)
+	res, err := extendLockScript.Run(ctx, b.client, []string{lease}, owner, ttl.Milliseconds()).Int()
+	return res == 1, err
+}
+
+func (b *redisLockBackend) release(ctx context.Context, key string, owner string) (bool, error) {
+	lease, _ := redisLockKeys(key)
+	res, err := releaseLockScript.Run(ctx, b.client, []string{lease}, owner).Int()
+	return res == 1, err
+}
+
+// ===============================================================================	Memory	Lock	=========================================================================
+type memoryLease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// memoryLockBackend keeps one fencing counter for all keys, tokens still grow
+// for every key while nothing is kept around once its lease is released or expired
+type memoryLockBackend struct {
+	mtx    sync.Mutex
+	leases map[string]memoryLease
+	fence  int64
+}
+
+func newMemoryLockBackend() *memoryLockBackend {
+	return &memoryLockBackend{
+		leases: map[string]memoryLease{},
+	}
+}
+
+// held returns the lease of key when it has not expired, the lock must be held
+func (b *memoryLockBackend) held(key string) (memoryLease, bool) {
+	lease, ok := b.leases[key]
+	if ok && time.Now().After(lease.expiresAt) {
+		delete(b.leases, key)
+		return memoryLease{}, false
+	}
+	return lease, ok
+}
+
+func (b *memoryLockBackend) acquire(
+	ctx context.Context,
+	key string,
+	owner string,
+	ttl time.Duration,
+) (int64, bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.held(key); ok {
+		return 0, false, nil
+	}
+	b.leases[key] = memoryLease{owner: owner, expiresAt: time.Now().Add(ttl)}
+	b.fence++
+	return b.fence, true, nil
+}
+
+func (b *memoryLockBackend) extend(
+	ctx context.Context,
+	key string,
+	owner string,
+	ttl time.Duration,
+) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	lease, ok := b.held(key)
+	if !ok || lease.owner != owner {
+		return false, nil
+	}
+	b.leases[key] = memoryLease{owner: owner, expiresAt: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryLockBackend) release(ctx context.Context, key string, owner string) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	lease, ok := b.held(key)
+	if !ok || lease.owner != owner {
+		return false, nil
+	}
+	delete(b.leases, key)
+	return true, nil
+}
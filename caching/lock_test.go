@@ -0,0 +1,163 @@
+package caching
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLocker(t *testing.T, l Locker, key string) {
+	ctx := context.Background()
+	first, err := l.TryAcquire(ctx, key, time.Second)
+	assert.Nil(t, err)
+	_, err = l.TryAcquire(ctx, key, time.Second)
+	assert.Equal(t, Err_LOCK_NOT_ACQUIRED, err)
+
+	// a waiting caller gets the lock once it is released, with a larger token
+	acquired := make(chan Lock)
+	go func() {
+		second, err := l.Acquire(ctx, key, time.Second)
+		assert.Nil(t, err)
+		acquired <- second
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, first.Release(ctx))
+	second := <-acquired
+	assert.Greater(t, second.Token(), first.Token())
+	assert.Equal(t, Err_LOCK_NOT_HELD, first.Release(ctx))
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(timeout, key, time.Second)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, second.Release(ctx))
+}
+
+func testLockerExtension(t *testing.T, l Locker, key string) {
+	ctx := context.Background()
+	lock, err := l.TryAcquire(ctx, key, 60*time.Millisecond)
+	assert.Nil(t, err)
+	// the lease outlives its ttl while the lock is held
+	time.Sleep(150 * time.Millisecond)
+	_, err = l.TryAcquire(ctx, key, time.Second)
+	assert.Equal(t, Err_LOCK_NOT_ACQUIRED, err)
+	select {
+	case <-lock.Lost():
+		t.Fatal("lease lost")
+	default:
+	}
+	assert.Nil(t, lock.Release(ctx))
+}
+
+func TestMemoryLockerKeepsNothingAfterRelease(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryLockBackend()
+	l := newLocker(backend, &LockerOptions{ExtendInterval: -1})
+	last := int64(0)
+	for i := 0; i < 100; i++ {
+		lock, err := l.TryAcquire(ctx, "job"+strconv.Itoa(i), time.Second)
+		assert.Nil(t, err)
+		assert.Greater(t, lock.Token(), last)
+		last = lock.Token()
+		assert.Nil(t, lock.Release(ctx))
+	}
+	assert.Empty(t, backend.leases)
+
+	// a key locked again after its lease expired still gets a larger token
+	expired, err := l.TryAcquire(ctx, "job0", 10*time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	lock, err := l.TryAcquire(ctx, "job0", time.Second)
+	assert.Nil(t, err)
+	assert.Greater(t, lock.Token(), expired.Token())
+	assert.Nil(t, lock.Release(ctx))
+	assert.Empty(t, backend.leases)
+}
+
+func TestMemoryLockerMutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	var holders int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		// lockers of the same cache share their locks
+		l, err := NewLocker(c, &LockerOptions{RetryInterval: time.Millisecond})
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := l.Acquire(ctx, "job", time.Second)
+			assert.Nil(t, err)
+			assert.Equal(t, int32(1), atomic.AddInt32(&holders, 1))
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			assert.Nil(t, lock.Release(ctx))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLockLost(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker(&LockerOptions{ExtendInterval: -1})
+	lock, err := l.TryAcquire(ctx, "job", 10*time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	other, err := l.TryAcquire(ctx, "job", time.Second)
+	assert.Nil(t, err)
+	// the new holder fences off the one whose lease expired
+	assert.Greater(t, other.Token(), lock.Token())
+	assert.Equal(t, Err_LOCK_NOT_HELD, lock.Extend(ctx, time.Second))
+	<-lock.Lost()
+	assert.Equal(t, Err_LOCK_NOT_HELD, lock.Release(ctx))
+	assert.Nil(t, other.Release(ctx))
+}
+
+func TestLockerUnsupported(t *testing.T) {
+	_, err := NewLocker(createSuccessMockCacher(), nil)
+	assert.Equal(t, Err_UNSUPPORTED_LOCKER, err)
+	disk := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+	_, err = NewLocker(disk, nil)
+	assert.Equal(t, Err_UNSUPPORTED_LOCKER, err)
+	_, err = NewRedisLocker(nil, nil)
+	assert.Equal(t, Err_INVALID_LOCK_CLIENT, err)
+	_, err = NewMemoryLocker(nil).TryAcquire(context.Background(), "job", 0)
+	assert.Equal(t, Err_INVALID_LOCK_TTL, err)
+}
+
+func TestLockerNamespaces(t *testing.T) {
+	redisUri := testRedisURI(t)
+	redisCache, err := InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	defer redisCache.Close()
+	for _, c := range []Cache{InitMemoryCache(time.Minute, time.Minute), redisCache} {
+		ctx := context.Background()
+		orders, err := NewLocker(c.WithName("orders"), nil)
+		assert.Nil(t, err)
+		users, err := NewLocker(c.WithName("users"), nil)
+		assert.Nil(t, err)
+		versioned, err := NewLocker(c.WithName("orders").WithVersion(2), nil)
+		assert.Nil(t, err)
+		same, err := NewLocker(c.WithName("orders"), nil)
+		assert.Nil(t, err)
+
+		lock, err := orders.TryAcquire(ctx, "namespaced_job", time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, "namespaced_job", lock.Key())
+		other, err := users.TryAcquire(ctx, "namespaced_job", time.Second)
+		assert.Nil(t, err)
+		assert.Nil(t, other.Release(ctx))
+		other, err = versioned.TryAcquire(ctx, "namespaced_job", time.Second)
+		assert.Nil(t, err)
+		assert.Nil(t, other.Release(ctx))
+		_, err = same.TryAcquire(ctx, "namespaced_job", time.Second)
+		assert.Equal(t, Err_LOCK_NOT_ACQUIRED, err)
+		assert.Nil(t, lock.Release(ctx))
+	}
+}
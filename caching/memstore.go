@@ -0,0 +1,143 @@
+package caching
+
+import (
+	"sync"
+	"time"
+
+	gc "github.com/patrickmn/go-cache"
+)
+
+// keep_ttl keeps the expiration of an existing entry, new entries get the store default
+const keep_ttl time.Duration = -2
+
+// updateFn receives the current value of a key and whether it exists, it returns the
+// value to store and false to leave the entry untouched
+type updateFn func(current interface{}, found bool) (interface{}, bool)
+
+// memStore is the in-memory backend of memory and two tier caches
+// ttl follows go-cache semantics: gc.DefaultExpiration (0) applies the store default
+// and gc.NoExpiration (-1) keeps the entry until it is deleted or evicted
+type memStore interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+	// Update runs fn and stores its result atomically, ttl may be keep_ttl
+	Update(key string, ttl time.Duration, fn updateFn)
+	// Add stores value only when key is missing or expired and reports whether it did
+	Add(key string, value interface{}, ttl time.Duration) bool
+	// Increment adds delta to the integer stored at key, a missing key counts as 0
+	// and an existing key keeps its expiration
+	Increment(key string, delta int64) (int64, error)
+	// Keys returns the keys of the entries that have not expired
+	Keys() []string
+	// Items returns a copy of the entries that have not expired
+	Items() map[string]gc.Item
+	// Len returns the number of entries, expired ones included until they are purged
+	Len() int
+	// OnEvicted registers the callback invoked when an entry leaves the store
+	OnEvicted(fn func(key string, value interface{}))
+	close()
+}
+
+// goCacheStore adapts patrickmn/go-cache, it is unbounded
+// writes are serialized by mtx so Update can read and write without interleaving
+type goCacheStore struct {
+	*gc.Cache
+	mtx sync.Mutex
+}
+
+func newGoCacheStore(expiration time.Duration, cleanupInterval time.Duration) memStore {
+	return &goCacheStore{Cache: gc.New(expiration, cleanupInterval)}
+}
+
+func (s *goCacheStore) Set(key string, value interface{}, ttl time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.Cache.Set(key, value, ttl)
+}
+
+func (s *goCacheStore) Delete(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.Cache.Delete(key)
+}
+
+func (s *goCacheStore) Update(key string, ttl time.Duration, fn updateFn) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.update(key, ttl, fn)
+}
+
+// update is Update without taking the lock, the lock must be held
+func (s *goCacheStore) update(key string, ttl time.Duration, fn updateFn) {
+	current, expiresAt, found := s.Cache.GetWithExpiration(key)
+	value, ok := fn(current, found)
+	if !ok {
+		return
+	}
+	if ttl == keep_ttl {
+		ttl = gc.DefaultExpiration
+		if found && expiresAt.IsZero() {
+			ttl = gc.NoExpiration
+		} else if found {
+			ttl = time.Until(expiresAt)
+			if ttl <= 0 {
+				ttl = time.Nanosecond
+			}
+		}
+	}
+	s.Cache.Set(key, value, ttl)
+}
+
+// Add relies on go-cache's Add, mtx is still taken so it can't interleave with Update
+func (s *goCacheStore) Add(key string, value interface{}, ttl time.Duration) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.Cache.Add(key, value, ttl) == nil
+}
+
+// Increment relies on go-cache's Add and IncrementInt64, mtx is still taken so it can't
+// interleave with Update. IncrementInt64 only accepts int64 values and wraps on overflow,
+// so the value is checked first and other integer forms, like "5" stored by Set,
+// are rewritten as an int64
+func (s *goCacheStore) Increment(key string, delta int64) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	current, found := s.Cache.Get(key)
+	if !found {
+		if err := s.Cache.Add(key, delta, gc.DefaultExpiration); err != nil {
+			return 0, err
+		}
+		return delta, nil
+	}
+	n, ok := toInt64(current)
+	if !ok {
+		return 0, Err_NOT_AN_INTEGER
+	}
+	if n, ok = addInt64(n, delta); !ok {
+		return 0, Err_NOT_AN_INTEGER
+	}
+	if _, ok := current.(int64); ok {
+		return s.Cache.IncrementInt64(key, delta)
+	}
+	s.update(key, keep_ttl, func(current interface{}, found bool) (interface{}, bool) {
+		return n, true
+	})
+	return n, nil
+}
+
+func (s *goCacheStore) Keys() []string {
+	items := s.Items()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *goCacheStore) Len() int {
+	return s.ItemCount()
+}
+
+// close is a no-op, go-cache stops its janitor once the cache is garbage collected
+func (s *goCacheStore) close() {}
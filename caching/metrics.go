@@ -0,0 +1,353 @@
+package caching
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latency_buckets are the upper bounds of the latency histogram
+var latency_buckets = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// CacheStats is a snapshot of the metrics collected for a named cache
+type CacheStats struct {
+	Name       string
+	Type       string
+	Hits       uint64
+	Misses     uint64
+	Errors     uint64
+	Evictions  uint64
+	HitRatio   float64
+	Operations map[string]OperationStats
+}
+
+// OperationStats is the latency distribution of a single command (e.g. "GET")
+// Buckets are cumulative, each one counts the calls that took at most its UpperBound
+type OperationStats struct {
+	Count   uint64
+	Errors  uint64
+	Total   time.Duration
+	Buckets []LatencyBucket
+}
+
+// LatencyBucket is a single histogram bucket
+type LatencyBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+type cacheMetrics struct {
+	name      string
+	typ       string
+	hits      uint64
+	misses    uint64
+	errors    uint64
+	evictions uint64
+	mtx       sync.RWMutex
+	ops       map[string]*latencyHistogram
+}
+
+type latencyHistogram struct {
+	count   uint64
+	errors  uint64
+	total   int64
+	buckets []uint64
+}
+
+type metricsRegistry struct {
+	mtx        sync.Mutex
+	collectors map[string]*cacheMetrics
+}
+
+var registry = &metricsRegistry{collectors: map[string]*cacheMetrics{}}
+
+// metricsFor returns the collector of the named cache, instances sharing
+// a name and a type report into the same collector
+func metricsFor(name string, typ string) *cacheMetrics {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+	id := typ + "/" + name
+	m, ok := registry.collectors[id]
+	if !ok {
+		m = &cacheMetrics{
+			name: name,
+			typ:  typ,
+			ops:  map[string]*latencyHistogram{},
+		}
+		registry.collectors[id] = m
+	}
+	return m
+}
+
+// observe records the latency and the outcome of a command
+func (m *cacheMetrics) observe(command string, elapsed time.Duration, err error) {
+	h := m.histogram(command)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.total, int64(elapsed))
+	for i := range latency_buckets {
+		if elapsed <= latency_buckets[i] {
+			atomic.AddUint64(&h.buckets[i], 1)
+		}
+	}
+	if err != nil && !isMiss(err) {
+		atomic.AddUint64(&h.errors, 1)
+		atomic.AddUint64(&m.errors, 1)
+	}
+}
+
+func (m *cacheMetrics) histogram(command string) *latencyHistogram {
+	m.mtx.RLock()
+	h, ok := m.ops[command]
+	m.mtx.RUnlock()
+	if ok {
+		return h
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if h, ok = m.ops[command]; !ok {
+		h = &latencyHistogram{buckets: make([]uint64, len(latency_buckets))}
+		m.ops[command] = h
+	}
+	return h
+}
+
+func (m *cacheMetrics) hit(n int) {
+	atomic.AddUint64(&m.hits, uint64(n))
+}
+
+func (m *cacheMetrics) miss(n int) {
+	atomic.AddUint64(&m.misses, uint64(n))
+}
+
+func (m *cacheMetrics) evict() {
+	atomic.AddUint64(&m.evictions, 1)
+}
+
+func (m *cacheMetrics) snapshot() CacheStats {
+	s := CacheStats{
+		Name:       m.name,
+		Type:       m.typ,
+		Hits:       atomic.LoadUint64(&m.hits),
+		Misses:     atomic.LoadUint64(&m.misses),
+		Errors:     atomic.LoadUint64(&m.errors),
+		Evictions:  atomic.LoadUint64(&m.evictions),
+		Operations: map[string]OperationStats{},
+	}
+	if lookups := s.Hits + s.Misses; lookups > 0 {
+		s.HitRatio = float64(s.Hits) / float64(lookups)
+	}
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	for command, h := range m.ops {
+		op := OperationStats{
+			Count:   atomic.LoadUint64(&h.count),
+			Errors:  atomic.LoadUint64(&h.errors),
+			Total:   time.Duration(atomic.LoadInt64(&h.total)),
+			Buckets: make([]LatencyBucket, len(latency_buckets)),
+		}
+		for i := range latency_buckets {
+			op.Buckets[i] = LatencyBucket{
+				UpperBound: latency_buckets[i],
+				Count:      atomic.LoadUint64(&h.buckets[i]),
+			}
+		}
+		s.Operations[command] = op
+	}
+	return s
+}
+
+// Stats returns a snapshot of the metrics collected for the cache name
+//
+// returns:
+//   - CacheStats: hits, misses, errors, evictions and latency per command
+func (c *cacheImpl) Stats() CacheStats {
+	return c.metrics.snapshot()
+}
+
+// evictionTracker counts memory evictions, explicit deletes are marked
+// beforehand so the eviction callback can tell them apart from expirations.
+// the store is shared by the named copies of a cache, an eviction is counted
+// by the copy whose namespace holds the key
+type evictionTracker struct {
+	deleting sync.Map
+	metrics  *cacheMetrics
+	mtx      sync.RWMutex
+	prefixes map[string]*cacheMetrics
+}
+
+func newEvictionTracker(m *cacheMetrics) *evictionTracker {
+	return &evictionTracker{metrics: m, prefixes: map[string]*cacheMetrics{}}
+}
+
+// track counts the evictions of the keys under prefix with m
+func (t *evictionTracker) track(prefix string, m *cacheMetrics) {
+	if prefix == "" {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.prefixes[prefix] = m
+}
+
+// metricsOf returns the collector of the longest namespace holding the key
+func (t *evictionTracker) metricsOf(key string) *cacheMetrics {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	m, longest := t.metrics, 0
+	for prefix, pm := range t.prefixes {
+		if len(prefix) > longest && strings.HasPrefix(key, prefix) {
+			m, longest = pm, len(prefix)
+		}
+	}
+	return m
+}
+
+// onEvicted is registered as the memory store eviction callback
+func (t *evictionTracker) onEvicted(key string, _ interface{}) {
+	if _, ok := t.deleting.LoadAndDelete(key); ok {
+		return
+	}
+	t.metricsOf(key).evict()
+}
+
+// expired counts the keys purged from a store that has no eviction callback
+func (t *evictionTracker) expired(keys []string) {
+	for _, key := range keys {
+		t.metricsOf(key).evict()
+	}
+}
+
+// watchEvictions registers the memory store eviction callback, it counts the
+// evictions and drops the evicted keys from the tag index
+func (c *cacheImpl) watchEvictions() {
+	tags, evictions := c.tags, c.evictions
+	c.mem.OnEvicted(func(key string, value interface{}) {
+		tags.remove(key)
+		evictions.onEvicted(key, value)
+	})
+}
+
+// deleteMem removes a key from the memory store without counting it as an eviction
+func (c *cacheImpl) deleteMem(key string) {
+	if c.evictions != nil {
+		c.evictions.deleting.Store(key, struct{}{})
+		defer c.evictions.deleting.Delete(key)
+	}
+	c.mem.Delete(key)
+	c.tags.remove(key)
+}
+
+// AllStats returns a snapshot of every cache collector, sorted by type then name
+//
+// returns:
+//   - []CacheStats: snapshots
+func AllStats() []CacheStats {
+	registry.mtx.Lock()
+	ids := make([]string, 0, len(registry.collectors))
+	for id := range registry.collectors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	collectors := make([]*cacheMetrics, len(ids))
+	for i, id := range ids {
+		collectors[i] = registry.collectors[id]
+	}
+	registry.mtx.Unlock()
+	res := make([]CacheStats, len(collectors))
+	for i := range collectors {
+		res[i] = collectors[i].snapshot()
+	}
+	return res
+}
+
+// WritePrometheusMetrics writes the metrics of every cache in the prometheus text format
+// params:
+//   - w: writer
+//
+// returns:
+//   - error: error if any
+func WritePrometheusMetrics(w io.Writer) error {
+	stats := AllStats()
+	b := &strings.Builder{}
+	counters := []struct {
+		name  string
+		help  string
+		value func(s CacheStats) uint64
+	}{
+		{"stdlib_cache_hits_total", "Number of cache hits.", func(s CacheStats) uint64 { return s.Hits }},
+		{"stdlib_cache_misses_total", "Number of cache misses.", func(s CacheStats) uint64 { return s.Misses }},
+		{"stdlib_cache_errors_total", "Number of failed cache operations.", func(s CacheStats) uint64 { return s.Errors }},
+		{"stdlib_cache_evictions_total", "Number of entries evicted from memory.", func(s CacheStats) uint64 { return s.Evictions }},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, s := range stats {
+			fmt.Fprintf(b, "%s{%s} %d\n", counter.name, promLabels(s, ""), counter.value(s))
+		}
+	}
+	const histogram = "stdlib_cache_operation_duration_seconds"
+	fmt.Fprintf(b, "# HELP %s Latency of cache operations.\n# TYPE %s histogram\n", histogram, histogram)
+	for _, s := range stats {
+		commands := make([]string, 0, len(s.Operations))
+		for command := range s.Operations {
+			commands = append(commands, command)
+		}
+		sort.Strings(commands)
+		for _, command := range commands {
+			op := s.Operations[command]
+			labels := promLabels(s, command)
+			for _, bucket := range op.Buckets {
+				le := strconv.FormatFloat(bucket.UpperBound.Seconds(), 'g', -1, 64)
+				fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", histogram, labels, le, bucket.Count)
+			}
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", histogram, labels, op.Count)
+			fmt.Fprintf(b, "%s_sum{%s} %s\n", histogram, labels, strconv.FormatFloat(op.Total.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(b, "%s_count{%s} %d\n", histogram, labels, op.Count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// MetricsHandler serves the cache metrics in the prometheus text format
+//
+// returns:
+//   - http.Handler: handler
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WritePrometheusMetrics(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func promLabels(s CacheStats, command string) string {
+	labels := "name=\"" + promEscape(s.Name) + "\",type=\"" + promEscape(s.Type) + "\""
+	if command != "" {
+		labels += ",command=\"" + promEscape(command) + "\""
+	}
+	return labels
+}
+
+func promEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,89 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsHitsAndMisses(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute).WithName("metrics_hits")
+	assert.Nil(t, c.SetCtx(ctx, "key", "value"))
+	_, err := c.GetCtx(ctx, "key")
+	assert.Nil(t, err)
+	_, err = c.GetCtx(ctx, "missing")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+	_, err = c.GetManyCtx(ctx, []string{"key", "missing"})
+	assert.Nil(t, err)
+
+	stats := c.Stats()
+	assert.Equal(t, "metrics_hits", stats.Name)
+	assert.Equal(t, MEMORY_CACHE_TYPE, stats.Type)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(0), stats.Errors)
+	assert.Equal(t, 0.5, stats.HitRatio)
+	assert.Equal(t, uint64(2), stats.Operations["GET"].Count)
+	assert.Equal(t, uint64(1), stats.Operations["MGET"].Count)
+	assert.Equal(t, uint64(1), stats.Operations["SET"].Count)
+	last := stats.Operations["GET"].Buckets[len(latency_buckets)-1]
+	assert.Equal(t, time.Second, last.UpperBound)
+	assert.Equal(t, uint64(2), last.Count)
+}
+
+func TestStatsEvictions(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, 10*time.Millisecond).WithName("metrics_evictions")
+	assert.Nil(t, c.SetWithExpirationCtx(ctx, "expiring", "value", time.Millisecond))
+	assert.Nil(t, c.SetCtx(ctx, "deleted", "value"))
+	assert.Nil(t, c.DeleteCtx(ctx, "deleted"))
+	assert.Eventually(t, func() bool {
+		return c.Stats().Evictions == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStatsEvictionsPerName(t *testing.T) {
+	ctx := context.Background()
+	parent := InitMemoryCache(time.Minute, 10*time.Millisecond).WithName("metrics_parent")
+	child := parent.WithName("metrics_child")
+	sibling := parent.WithName("metrics_sibling")
+	assert.Nil(t, parent.SetWithExpirationCtx(ctx, "a", "value", time.Millisecond))
+	assert.Nil(t, parent.SetWithExpirationCtx(ctx, "b", "value", time.Millisecond))
+	assert.Nil(t, child.SetWithExpirationCtx(ctx, "a", "value", time.Millisecond))
+	assert.Eventually(t, func() bool {
+		return parent.Stats().Evictions == 2 && child.Stats().Evictions == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(0), sibling.Stats().Evictions)
+}
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute).WithName("metrics_prom")
+	assert.Nil(t, c.SetCtx(ctx, "key", "value"))
+	_, err := c.GetCtx(ctx, "key")
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, WritePrometheusMetrics(buf))
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE stdlib_cache_hits_total counter\n")
+	assert.Contains(t, out, `stdlib_cache_hits_total{name="metrics_prom",type="Memory"} 1`)
+	assert.Contains(t, out, `stdlib_cache_misses_total{name="metrics_prom",type="Memory"} 0`)
+	assert.Contains(t, out, `stdlib_cache_operation_duration_seconds_bucket{name="metrics_prom",type="Memory",command="GET",le="+Inf"} 1`)
+	assert.Contains(t, out, `stdlib_cache_operation_duration_seconds_count{name="metrics_prom",type="Memory",command="GET"} 1`)
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Body.String(), `stdlib_cache_hits_total{name="metrics_prom",type="Memory"} 1`)
+}
+
+func TestStatsMock(t *testing.T) {
+	assert.Equal(t, uint64(1), createSuccessMockCacher().Stats().Hits)
+	assert.Equal(t, uint64(1), createFailedMockCacher().Stats().Errors)
+}
@@ -3,6 +3,7 @@ package caching
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	tracer "github.com/BetaLixT/appInsightsTrace"
@@ -35,6 +36,10 @@ func (f *failedMockCache) WithTracer(t *tracer.AppInsightsCore) Cache {
 	return f
 }
 
+func (f *failedMockCache) WithHook(h Hook) Cache {
+	return f
+}
+
 func (m *mockCache) SetWithExpiration(key string, value interface{}, expiration time.Duration) error {
 	return nil
 }
@@ -68,6 +73,44 @@ func (f *failedMockCache) WithName(name string) Cache {
 	return f
 }
 
+func (f *failedMockCache) WithVersion(version int) Cache {
+	return f
+}
+
+func (f *failedMockCache) WithCompression(opts *CompressionOptions) Cache {
+	return f
+}
+
+func (f *failedMockCache) WithEncryption(k *Keyring) Cache {
+	return f
+}
+
+func (f *failedMockCache) WithInvalidationBus(bus InvalidationBus) Cache {
+	return f
+}
+
+func (f *failedMockCache) GetOrLoad(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	loader LoaderFn,
+) (interface{}, error) {
+	return nil, err_Sample_Error
+}
+
+func (f *failedMockCache) WithLoadLock(opts *LoadLockOptions) Cache {
+	return f
+}
+
+func (f *failedMockCache) GetOrRefresh(
+	ctx context.Context,
+	key string,
+	opts *RefreshOptions,
+	loader LoaderFn,
+) (interface{}, error) {
+	return nil, err_Sample_Error
+}
+
 func (f *failedMockCache) Keys(pattern string) ([]string, error) {
 	return nil, err_Sample_Error
 }
@@ -80,6 +123,44 @@ func (m *mockCache) WithName(name string) Cache {
 	return m
 }
 
+func (m *mockCache) WithVersion(version int) Cache {
+	return m
+}
+
+func (m *mockCache) WithCompression(opts *CompressionOptions) Cache {
+	return m
+}
+
+func (m *mockCache) WithEncryption(k *Keyring) Cache {
+	return m
+}
+
+func (m *mockCache) WithInvalidationBus(bus InvalidationBus) Cache {
+	return m
+}
+
+func (m *mockCache) GetOrLoad(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	loader LoaderFn,
+) (interface{}, error) {
+	return true, nil
+}
+
+func (m *mockCache) WithLoadLock(opts *LoadLockOptions) Cache {
+	return m
+}
+
+func (m *mockCache) GetOrRefresh(
+	ctx context.Context,
+	key string,
+	opts *RefreshOptions,
+	loader LoaderFn,
+) (interface{}, error) {
+	return true, nil
+}
+
 type mockCache struct{}
 
 func createSuccessMockCacher() Cache {
@@ -102,6 +183,10 @@ func (m *mockCache) WithTracer(t *tracer.AppInsightsCore) Cache {
 	return m
 }
 
+func (m *mockCache) WithHook(h Hook) Cache {
+	return m
+}
+
 func (m *mockCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
 	return true, nil
 }
@@ -125,3 +210,234 @@ func (m *mockCache) Keys(pattern string) ([]string, error) {
 func (m *mockCache) KeysCtx(ctx context.Context, pattern string) ([]string, error) {
 	return []string{}, nil
 }
+
+func (f *failedMockCache) GetManyCtx(ctx context.Context, keys []string) (*BulkResult, error) {
+	return nil, err_Sample_Error
+}
+
+func (f *failedMockCache) SetManyCtx(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	return err_Sample_Error
+}
+
+func (f *failedMockCache) DeleteManyCtx(ctx context.Context, keys []string) error {
+	return err_Sample_Error
+}
+
+func (m *mockCache) GetManyCtx(ctx context.Context, keys []string) (*BulkResult, error) {
+	found := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		found[key] = true
+	}
+	return &BulkResult{Found: found, Missing: []string{}}, nil
+}
+
+func (m *mockCache) SetManyCtx(
+	ctx context.Context,
+	items map[string]interface{},
+	expiration time.Duration,
+) error {
+	return nil
+}
+
+func (m *mockCache) DeleteManyCtx(ctx context.Context, keys []string) error {
+	return nil
+}
+
+type mockKeyIterator struct {
+	keys []string
+	key  string
+	err  error
+}
+
+func (it *mockKeyIterator) Next(ctx context.Context) bool {
+	if len(it.keys) == 0 {
+		return false
+	}
+	it.key = it.keys[0]
+	it.keys = it.keys[1:]
+	return true
+}
+
+func (it *mockKeyIterator) Key() string { return it.key }
+
+func (it *mockKeyIterator) Err() error { return it.err }
+
+func (f *failedMockCache) ScanCtx(ctx context.Context, pattern string, batch int64) KeyIterator {
+	return &mockKeyIterator{err: err_Sample_Error}
+}
+
+func (f *failedMockCache) DeletePattern(pattern string) (int, error) {
+	return 0, err_Sample_Error
+}
+
+func (f *failedMockCache) DeletePatternCtx(ctx context.Context, pattern string) (int, error) {
+	return 0, err_Sample_Error
+}
+
+func (m *mockCache) ScanCtx(ctx context.Context, pattern string, batch int64) KeyIterator {
+	return &mockKeyIterator{}
+}
+
+func (m *mockCache) DeletePattern(pattern string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockCache) DeletePatternCtx(ctx context.Context, pattern string) (int, error) {
+	return 0, nil
+}
+
+func (f *failedMockCache) SetWithTagsCtx(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+	tags ...string,
+) error {
+	return err_Sample_Error
+}
+
+func (f *failedMockCache) InvalidateTagCtx(ctx context.Context, tag string) error {
+	return err_Sample_Error
+}
+
+func (f *failedMockCache) IncrementCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return 0, err_Sample_Error
+}
+
+func (f *failedMockCache) SetIfAbsentCtx(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	return false, err_Sample_Error
+}
+
+func (f *failedMockCache) CompareAndSwapCtx(
+	ctx context.Context,
+	key string,
+	old interface{},
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	return false, err_Sample_Error
+}
+
+func (f *failedMockCache) Export(ctx context.Context, w io.Writer) (int, error) {
+	return 0, err_Sample_Error
+}
+
+func (f *failedMockCache) ExportPattern(
+	ctx context.Context,
+	w io.Writer,
+	pattern string,
+) (int, error) {
+	return 0, err_Sample_Error
+}
+
+func (f *failedMockCache) Import(ctx context.Context, r io.Reader) (int, error) {
+	return 0, err_Sample_Error
+}
+
+func (f *failedMockCache) Warm(
+	ctx context.Context,
+	keys []string,
+	opts *WarmOptions,
+	loader WarmFn,
+) (int, error) {
+	return 0, err_Sample_Error
+}
+
+func (f *failedMockCache) WithHealthCheck(opts *HealthCheckOptions) Cache {
+	return f
+}
+
+func (f *failedMockCache) Healthy() bool {
+	return false
+}
+
+func (f *failedMockCache) Close() error {
+	return err_Sample_Error
+}
+
+func (f *failedMockCache) Stats() CacheStats {
+	return CacheStats{Errors: 1}
+}
+
+func (m *mockCache) SetWithTagsCtx(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+	tags ...string,
+) error {
+	return nil
+}
+
+func (m *mockCache) InvalidateTagCtx(ctx context.Context, tag string) error {
+	return nil
+}
+
+func (m *mockCache) IncrementCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return delta, nil
+}
+
+func (m *mockCache) SetIfAbsentCtx(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	return true, nil
+}
+
+func (m *mockCache) CompareAndSwapCtx(
+	ctx context.Context,
+	key string,
+	old interface{},
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	return true, nil
+}
+
+func (m *mockCache) Export(ctx context.Context, w io.Writer) (int, error) {
+	return 0, nil
+}
+
+func (m *mockCache) ExportPattern(ctx context.Context, w io.Writer, pattern string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockCache) Import(ctx context.Context, r io.Reader) (int, error) {
+	return 0, nil
+}
+
+func (m *mockCache) Warm(
+	ctx context.Context,
+	keys []string,
+	opts *WarmOptions,
+	loader WarmFn,
+) (int, error) {
+	return len(keys), nil
+}
+
+func (m *mockCache) WithHealthCheck(opts *HealthCheckOptions) Cache {
+	return m
+}
+
+func (m *mockCache) Healthy() bool {
+	return true
+}
+
+func (m *mockCache) Close() error {
+	return nil
+}
+
+func (m *mockCache) Stats() CacheStats {
+	return CacheStats{Hits: 1, HitRatio: 1}
+}
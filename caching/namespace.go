@@ -0,0 +1,98 @@
+package caching
+
+import (
+	"strconv"
+	"strings"
+)
+
+// name_escaper percent encodes the separator and the version marker in names so
+// "a:b" and "a" with a version or another segment can never build the same prefix
+var name_escaper = strings.NewReplacer("%", "%25", ":", "%3A", "@", "%40")
+
+// namespacePrefix builds the prefix of the keys of a named cache, e.g. "orders:@v3:",
+// the version segment starts with "@" which escaped names never contain
+func namespacePrefix(name string, version int) string {
+	prefix := ""
+	if name != "" {
+		prefix = name_escaper.Replace(name) + ":"
+	}
+	if version > 0 {
+		prefix += "@v" + strconv.Itoa(version) + ":"
+	}
+	return prefix
+}
+
+// WithVersion returns a new instance of Cache whose keys carry a schema version
+// after the name, e.g. "orders:@v3:key", bumping the version hides every entry written
+// with the previous one, they are left to expire, a cache with the same name and no
+// version still sees them as "@v3:key"
+// params:
+//   - version: schema version, 0 removes the version
+//
+// returns:
+//   - Cache: cache instance
+func (c *cacheImpl) WithVersion(version int) Cache {
+	newC := c.clone()
+	newC.version = version
+	newC.prefix = namespacePrefix(newC.name, version)
+	if newC.evictions != nil {
+		newC.evictions.track(newC.prefix, newC.metrics)
+	}
+	return newC
+}
+
+// key returns the stored key of a namespaced key
+func (c *cacheImpl) key(key string) string {
+	return c.prefix + key
+}
+
+// keysOf returns the stored keys of namespaced keys
+func (c *cacheImpl) keysOf(keys []string) []string {
+	if c.prefix == "" {
+		return keys
+	}
+	stored := make([]string, len(keys))
+	for i, key := range keys {
+		stored[i] = c.prefix + key
+	}
+	return stored
+}
+
+// unkey strips the namespace from a stored key
+func (c *cacheImpl) unkey(key string) string {
+	return strings.TrimPrefix(key, c.prefix)
+}
+
+// pattern scopes a glob pattern to the namespace, the prefix is matched literally
+func (c *cacheImpl) pattern(pattern string) string {
+	if c.prefix == "" {
+		return pattern
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+	return escapeGlob(c.prefix) + pattern
+}
+
+// escapeGlob escapes the glob special characters of s
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// namespacedIterator strips the namespace from the keys of an iterator
+type namespacedIterator struct {
+	KeyIterator
+	c *cacheImpl
+}
+
+func (it *namespacedIterator) Key() string {
+	return it.c.unkey(it.KeyIterator.Key())
+}
@@ -0,0 +1,135 @@
+package caching
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testNamespaces(t *testing.T, c Cache, prefix string) {
+	ctx := context.Background()
+	orders := c.WithName(prefix + "orders")
+	users := c.WithName(prefix + "users")
+	_, err := orders.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+	_, err = users.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+
+	assert.Nil(t, orders.SetCtx(ctx, "1", "order"))
+	assert.Nil(t, users.SetCtx(ctx, "1", "user"))
+	v, err := orders.GetCtx(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "order", v)
+	v, err = users.GetCtx(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "user", v)
+	v, err = c.GetCtx(ctx, prefix+"orders:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "order", v)
+
+	// keys come back without the namespace
+	keys, err := orders.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, keys)
+	res, err := users.GetManyCtx(ctx, []string{"1", "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"1": "user"}, res.Found)
+	assert.Equal(t, []string{"2"}, res.Missing)
+
+	// tags are scoped to the namespace as well
+	assert.Nil(t, orders.SetWithTagsCtx(ctx, "2", "order", time.Minute, "tenant"))
+	assert.Nil(t, users.SetWithTagsCtx(ctx, "2", "user", time.Minute, "tenant"))
+	assert.Nil(t, orders.InvalidateTagCtx(ctx, "tenant"))
+	_, err = orders.GetCtx(ctx, "2")
+	assert.True(t, isMiss(err))
+	_, err = users.GetCtx(ctx, "2")
+	assert.Nil(t, err)
+
+	// bumping the version hides the previous entries
+	v3 := orders.WithVersion(3)
+	_, err = v3.GetCtx(ctx, "1")
+	assert.True(t, isMiss(err))
+	assert.Nil(t, v3.SetCtx(ctx, "1", "order v3"))
+	keys, err = v3.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, keys)
+	v, err = c.GetCtx(ctx, prefix+"orders:@v3:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "order v3", v)
+	v, err = orders.GetCtx(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "order", v)
+
+	// the unversioned namespace contains the versioned ones
+	keys, err = orders.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1", "@v3:1"}, keys)
+	deleted, err := v3.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	deleted, err = orders.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = users.GetCtx(ctx, "1")
+	assert.Nil(t, err)
+	_, err = users.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+}
+
+func TestNamespacePrefix(t *testing.T) {
+	assert.Equal(t, "", namespacePrefix("", 0))
+	assert.Equal(t, "orders:", namespacePrefix("orders", 0))
+	assert.Equal(t, "orders:@v3:", namespacePrefix("orders", 3))
+	assert.Equal(t, "@v2:", namespacePrefix("", 2))
+	// separators in names are escaped so prefixes never collide
+	assert.Equal(t, "a%3Ab:", namespacePrefix("a:b", 0))
+	assert.Equal(t, "a%253A:", namespacePrefix("a%3A", 0))
+	assert.NotEqual(t, namespacePrefix("orders:v3", 0), namespacePrefix("orders", 3))
+	assert.NotEqual(t, namespacePrefix("orders:@v3", 0), namespacePrefix("orders", 3))
+	// a version can't be mistaken for a name either
+	assert.NotEqual(t, namespacePrefix("v3", 0), namespacePrefix("", 3))
+	assert.NotEqual(t, namespacePrefix("@v3", 0), namespacePrefix("", 3))
+	assert.Equal(t, "%40v3:", namespacePrefix("@v3", 0))
+	// the name keeps its version when it changes
+	c := InitMemoryCache(time.Minute, time.Minute).WithVersion(2).WithName("orders")
+	assert.Equal(t, "orders:@v2:", c.(*cacheImpl).prefix)
+}
+
+func TestNamespaceVersionIsNotAName(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.WithVersion(3).SetCtx(ctx, "key", "versioned"))
+	assert.Nil(t, c.WithName("v3").SetCtx(ctx, "key", "named"))
+	v, err := c.WithVersion(3).GetCtx(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "versioned", v)
+	v, err = c.WithName("v3").GetCtx(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "named", v)
+}
+
+func TestNamespaceGlobCharacters(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	star := c.WithName("a*")
+	assert.Nil(t, star.SetCtx(ctx, "key", "v"))
+	assert.Nil(t, c.WithName("ab").SetCtx(ctx, "key", "v"))
+	keys, err := star.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key"}, keys)
+}
+
+func TestNamespaceSeparators(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.WithName("a:b").SetCtx(ctx, "c", "nested name"))
+	assert.Nil(t, c.WithName("a").SetCtx(ctx, "b:c", "nested key"))
+	v, err := c.WithName("a:b").GetCtx(ctx, "c")
+	assert.Nil(t, err)
+	assert.Equal(t, "nested name", v)
+	keys, err := c.WithName("a:b").KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c"}, keys)
+}
@@ -0,0 +1,325 @@
+package caching
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+// evictionPolicy orders the entries of a bounded store, it is only
+// called with the store lock held
+type evictionPolicy interface {
+	// add records a new entry
+	add(e *boundedEntry)
+	// touch records a read or an update of an existing entry
+	touch(e *boundedEntry)
+	// remove forgets an entry that left the store
+	remove(e *boundedEntry)
+	// victim returns the entry to evict when the store is over budget
+	victim() *boundedEntry
+}
+
+func newEvictionPolicy(policy EvictionPolicy, capacity int64, weight func(e *boundedEntry) int64) evictionPolicy {
+	switch policy {
+	case LFU_EVICTION_POLICY:
+		return newLFUPolicy()
+	case TINY_LFU_EVICTION_POLICY:
+		return newTinyLFUPolicy(capacity, weight)
+	default:
+		return newLRUPolicy()
+	}
+}
+
+// ===============================================================================	LRU	=========================================================================
+type lruPolicy struct {
+	ll *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{ll: list.New()}
+}
+
+func (p *lruPolicy) add(e *boundedEntry) {
+	e.elem = p.ll.PushFront(e)
+}
+
+func (p *lruPolicy) touch(e *boundedEntry) {
+	p.ll.MoveToFront(e.elem)
+}
+
+func (p *lruPolicy) remove(e *boundedEntry) {
+	p.ll.Remove(e.elem)
+}
+
+func (p *lruPolicy) victim() *boundedEntry {
+	if back := p.ll.Back(); back != nil {
+		return back.Value.(*boundedEntry)
+	}
+	return nil
+}
+
+// ===============================================================================	LFU	=========================================================================
+// lfuPolicy keeps one list per access frequency, ties are broken by recency
+// the newest entry is never picked as a victim, it would always be the least frequent one
+type lfuPolicy struct {
+	buckets map[uint64]*list.List
+	minFreq uint64
+	newest  *boundedEntry
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{buckets: map[uint64]*list.List{}}
+}
+
+func (p *lfuPolicy) push(e *boundedEntry) {
+	ll, ok := p.buckets[e.freq]
+	if !ok {
+		ll = list.New()
+		p.buckets[e.freq] = ll
+	}
+	e.elem = ll.PushFront(e)
+}
+
+func (p *lfuPolicy) unlink(e *boundedEntry) {
+	ll := p.buckets[e.freq]
+	ll.Remove(e.elem)
+	if ll.Len() == 0 {
+		delete(p.buckets, e.freq)
+	}
+}
+
+func (p *lfuPolicy) add(e *boundedEntry) {
+	e.freq = 1
+	p.push(e)
+	p.minFreq = 1
+	p.newest = e
+}
+
+func (p *lfuPolicy) touch(e *boundedEntry) {
+	p.unlink(e)
+	if e.freq == p.minFreq && p.buckets[e.freq] == nil {
+		p.minFreq++
+	}
+	e.freq++
+	p.push(e)
+}
+
+func (p *lfuPolicy) remove(e *boundedEntry) {
+	if p.newest == e {
+		p.newest = nil
+	}
+	p.unlink(e)
+}
+
+func (p *lfuPolicy) victim() *boundedEntry {
+	if len(p.buckets) == 0 {
+		return nil
+	}
+	ll, ok := p.buckets[p.minFreq]
+	if !ok {
+		// the least frequent entries were deleted, look the minimum up again
+		first := true
+		for freq := range p.buckets {
+			if first || freq < p.minFreq {
+				p.minFreq = freq
+				first = false
+			}
+		}
+		ll = p.buckets[p.minFreq]
+	}
+	v := ll.Back().Value.(*boundedEntry)
+	if v != p.newest || ll.Len() > 1 {
+		return v
+	}
+	// the newest entry is alone at the lowest frequency, take the next one
+	var next *list.List
+	var nextFreq uint64
+	for freq, l := range p.buckets {
+		if freq != p.minFreq && (next == nil || freq < nextFreq) {
+			next, nextFreq = l, freq
+		}
+	}
+	if next == nil {
+		return v
+	}
+	return next.Back().Value.(*boundedEntry)
+}
+
+// ===============================================================================	W-TinyLFU	=========================================================================
+const (
+	tiny_lfu_window    = 1
+	tiny_lfu_probation = 2
+	tiny_lfu_protected = 3
+)
+
+// tinyLFUPolicy is a W-TinyLFU policy, new entries land in a small LRU window,
+// entries leaving the window are only admitted in the main segmented LRU when
+// their estimated frequency beats the one of the entry they would replace
+type tinyLFUPolicy struct {
+	sketch          *countMinSketch
+	weight          func(e *boundedEntry) int64
+	window          *list.List
+	probation       *list.List
+	protected       *list.List
+	windowWeight    int64
+	protectedWeight int64
+	windowMax       int64
+	protectedMax    int64
+	candidate       *boundedEntry
+}
+
+func newTinyLFUPolicy(capacity int64, weight func(e *boundedEntry) int64) *tinyLFUPolicy {
+	windowMax := capacity / 100
+	if windowMax < 1 {
+		windowMax = 1
+	}
+	return &tinyLFUPolicy{
+		sketch:       newCountMinSketch(capacity),
+		weight:       weight,
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		windowMax:    windowMax,
+		protectedMax: (capacity - windowMax) * 8 / 10,
+	}
+}
+
+func (p *tinyLFUPolicy) add(e *boundedEntry) {
+	p.sketch.increment(e.key)
+	e.segment = tiny_lfu_window
+	e.elem = p.window.PushFront(e)
+	p.windowWeight += p.weight(e)
+	// the window overflows into probation, the last entry moved is the admission candidate
+	for p.windowWeight > p.windowMax && p.window.Len() > 1 {
+		moved := p.window.Remove(p.window.Back()).(*boundedEntry)
+		p.windowWeight -= p.weight(moved)
+		moved.segment = tiny_lfu_probation
+		moved.elem = p.probation.PushFront(moved)
+		p.candidate = moved
+	}
+}
+
+func (p *tinyLFUPolicy) touch(e *boundedEntry) {
+	p.sketch.increment(e.key)
+	switch e.segment {
+	case tiny_lfu_window:
+		p.window.MoveToFront(e.elem)
+	case tiny_lfu_protected:
+		p.protected.MoveToFront(e.elem)
+	case tiny_lfu_probation:
+		if p.candidate == e {
+			p.candidate = nil
+		}
+		p.probation.Remove(e.elem)
+		e.segment = tiny_lfu_protected
+		e.elem = p.protected.PushFront(e)
+		p.protectedWeight += p.weight(e)
+		for p.protectedWeight > p.protectedMax && p.protected.Len() > 1 {
+			demoted := p.protected.Remove(p.protected.Back()).(*boundedEntry)
+			p.protectedWeight -= p.weight(demoted)
+			demoted.segment = tiny_lfu_probation
+			demoted.elem = p.probation.PushFront(demoted)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) remove(e *boundedEntry) {
+	if p.candidate == e {
+		p.candidate = nil
+	}
+	switch e.segment {
+	case tiny_lfu_window:
+		p.window.Remove(e.elem)
+		p.windowWeight -= p.weight(e)
+	case tiny_lfu_probation:
+		p.probation.Remove(e.elem)
+	case tiny_lfu_protected:
+		p.protected.Remove(e.elem)
+		p.protectedWeight -= p.weight(e)
+	}
+}
+
+func (p *tinyLFUPolicy) victim() *boundedEntry {
+	if back := p.probation.Back(); back != nil {
+		v := back.Value.(*boundedEntry)
+		candidate := p.candidate
+		p.candidate = nil
+		if candidate == nil || candidate == v {
+			return v
+		}
+		// admit the candidate only when it is used more often than the victim
+		if p.sketch.estimate(candidate.key) > p.sketch.estimate(v.key) {
+			return v
+		}
+		return candidate
+	}
+	if back := p.protected.Back(); back != nil {
+		return back.Value.(*boundedEntry)
+	}
+	if back := p.window.Back(); back != nil {
+		return back.Value.(*boundedEntry)
+	}
+	return nil
+}
+
+// countMinSketch estimates access frequencies in constant space, counters are
+// halved once enough increments were recorded so old popularity fades out
+type countMinSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int64) *countMinSketch {
+	width := uint64(64)
+	for int64(width) < capacity && width < 1<<20 {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:    width - 1,
+		resetAt: int(width) * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	lo, hi := sum, (sum>>32)|1
+	idx := [4]uint64{}
+	for i := range idx {
+		idx[i] = (lo + uint64(i)*hi) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < 15 {
+			s.rows[i][j]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.additions = 0
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(15)
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+	return min
+}
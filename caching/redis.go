@@ -0,0 +1,151 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+var Err_INVALID_REDIS_OPTIONS = fmt.Errorf("invalid redis options")
+
+// InitRedisCacheWithOptions initializes cache with redis type from client options
+// TLS is enabled by setting opts.TLSConfig
+// params:
+//   - opts: redis client options
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitRedisCacheWithOptions(
+	opts *redis.Options,
+) (Cache, error) {
+	if opts == nil {
+		return nil, Err_INVALID_REDIS_OPTIONS
+	}
+	return newRedisCache(redis.NewClient(opts), true), nil
+}
+
+// InitRedisFailoverCache initializes cache with redis type backed by sentinel
+// the client follows the master elected by the sentinels
+// params:
+//   - opts: sentinel failover options, MasterName and SentinelAddrs are required
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitRedisFailoverCache(
+	opts *redis.FailoverOptions,
+) (Cache, error) {
+	if opts == nil || opts.MasterName == "" || len(opts.SentinelAddrs) == 0 {
+		return nil, Err_INVALID_REDIS_OPTIONS
+	}
+	return newRedisCache(redis.NewFailoverClient(opts), true), nil
+}
+
+// InitRedisClusterCache initializes cache with redis type backed by a redis cluster
+// multi key operations are split per key and SCAN walks every master node
+// params:
+//   - opts: cluster options, Addrs is required
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitRedisClusterCache(
+	opts *redis.ClusterOptions,
+) (Cache, error) {
+	if opts == nil || len(opts.Addrs) == 0 {
+		return nil, Err_INVALID_REDIS_OPTIONS
+	}
+	return newRedisCache(redis.NewClusterClient(opts), true), nil
+}
+
+// InitRedisCacheWithClient initializes cache with redis type around an existing client
+// params:
+//   - client: a *redis.Client, *redis.ClusterClient or sentinel backed client
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitRedisCacheWithClient(
+	client redis.UniversalClient,
+) (Cache, error) {
+	if client == nil {
+		return nil, Err_INVALID_REDIS_OPTIONS
+	}
+	return newRedisCache(client, false), nil
+}
+
+// RedisClient returns the redis client behind redis and two tier caches so other
+// packages can run their own commands on the same connection
+// params:
+//   - c: cache
+//
+// returns:
+//   - redis.UniversalClient: client
+//   - bool: false when the cache is not backed by redis
+func RedisClient(c Cache) (redis.UniversalClient, bool) {
+	impl, ok := c.(*cacheImpl)
+	if !ok || impl.redis == nil {
+		return nil, false
+	}
+	return impl.redis, true
+}
+
+// KeyPrefix returns the prefix the name and version of the cache add to its keys
+// so packages writing to the same connection stay within its namespace
+// params:
+//   - c: cache
+//
+// returns:
+//   - string: prefix, empty for unnamed caches and caches of other packages
+func KeyPrefix(c Cache) string {
+	impl, ok := c.(*cacheImpl)
+	if !ok {
+		return ""
+	}
+	return impl.prefix
+}
+
+// newRedisCache builds a redis cache and starts its health monitor
+// closeClient tells whether Close closes the client as well
+func newRedisCache(client redis.UniversalClient, closeClient bool) *cacheImpl {
+	return &cacheImpl{
+		typ:     REDIS_CACHE_TYPE,
+		redis:   client,
+		lgr:     zap.NewNop(),
+		flights: newFlightGroup(),
+		health:  newHealthMonitor(client, REDIS_CACHE_TYPE, closeClient),
+		metrics: metricsFor("", REDIS_CACHE_TYPE),
+	}
+}
+
+// isCluster reports whether the redis client talks to a redis cluster
+// where multi key commands fail unless every key hashes to the same slot
+func (c *cacheImpl) isCluster() bool {
+	_, ok := c.redis.(*redis.ClusterClient)
+	return ok
+}
+
+// scanNodes returns the clients SCAN has to walk to cover the whole keyspace
+func (c *cacheImpl) scanNodes(ctx context.Context) ([]redis.Cmdable, error) {
+	cluster, ok := c.redis.(*redis.ClusterClient)
+	if !ok {
+		return []redis.Cmdable{c.redis}, nil
+	}
+	nodes := []redis.Cmdable{}
+	mtx := sync.Mutex{}
+	// ForEachMaster calls back concurrently
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
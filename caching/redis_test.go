@@ -0,0 +1,131 @@
+package caching
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRedisURI returns REDIS_URI, or the uri of an in-process miniredis when
+// it is not set so the redis code paths always run
+func testRedisURI(t *testing.T) string {
+	if uri := os.Getenv("REDIS_URI"); uri != "" {
+		return uri
+	}
+	return "redis://" + miniredis.RunT(t).Addr()
+}
+
+// testRedisClusterAddr returns REDIS_CLUSTER_ADDR, or the address of an in-process
+// miniredis answering the cluster commands as a single node cluster
+func testRedisClusterAddr(t *testing.T) string {
+	if addr := os.Getenv("REDIS_CLUSTER_ADDR"); addr != "" {
+		return addr
+	}
+	return miniredis.RunT(t).Addr()
+}
+
+func TestInitRedisInvalidOptions(t *testing.T) {
+	_, err := InitRedisCacheWithOptions(nil)
+	assert.Equal(t, Err_INVALID_REDIS_OPTIONS, err)
+	_, err = InitRedisFailoverCache(&redis.FailoverOptions{SentinelAddrs: []string{"localhost:26379"}})
+	assert.Equal(t, Err_INVALID_REDIS_OPTIONS, err)
+	_, err = InitRedisClusterCache(&redis.ClusterOptions{})
+	assert.Equal(t, Err_INVALID_REDIS_OPTIONS, err)
+	_, err = InitRedisCacheWithClient(nil)
+	assert.Equal(t, Err_INVALID_REDIS_OPTIONS, err)
+	_, err = InitTwoTierCacheWithClient(nil, nil)
+	assert.Equal(t, Err_INVALID_REDIS_OPTIONS, err)
+}
+
+func TestInitRedisCacheWithOptions(t *testing.T) {
+	redisUri := testRedisURI(t)
+	opts, err := redis.ParseURL(redisUri)
+	assert.Nil(t, err)
+	c, err := InitRedisCacheWithOptions(opts)
+	assert.Nil(t, err)
+	testBulkOperations(t, c, "options_redis_")
+
+	client := redis.NewClient(opts)
+	c, err = InitTwoTierCacheWithClient(client, nil)
+	assert.Nil(t, err)
+	testBulkOperations(t, c, "client_two_tier_")
+
+	bus, err := NewRedisInvalidationBusWithClient(client, "")
+	assert.Nil(t, err)
+	assert.Nil(t, bus.Close())
+	// the bus does not own the client, it must still be usable
+	assert.Nil(t, client.Ping(context.Background()).Err())
+}
+
+// commandRecorder records the commands sent through a redis client
+type commandRecorder struct {
+	mtx  sync.Mutex
+	cmds []redis.Cmder
+}
+
+func (r *commandRecorder) record(cmds ...redis.Cmder) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cmds = append(r.cmds, cmds...)
+}
+
+func (r *commandRecorder) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	r.record(cmd)
+	return ctx, nil
+}
+
+func (r *commandRecorder) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (r *commandRecorder) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	r.record(cmds...)
+	return ctx, nil
+}
+
+func (r *commandRecorder) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestInitRedisClusterCache(t *testing.T) {
+	clusterAddr := testRedisClusterAddr(t)
+	c, err := InitRedisClusterCache(&redis.ClusterOptions{Addrs: []string{clusterAddr}})
+	assert.Nil(t, err)
+	defer c.Close()
+	client, ok := RedisClient(c)
+	assert.True(t, ok)
+	recorder := &commandRecorder{}
+	client.AddHook(recorder)
+
+	// keys of a bulk call land on different slots, they are split into single key commands
+	ctx := context.Background()
+	keys := []string{"cluster_a", "cluster_b", "cluster_c"}
+	assert.Nil(t, c.SetManyCtx(ctx, map[string]interface{}{"cluster_a": "1", "cluster_b": "2"}, time.Minute))
+	res, err := c.GetManyCtx(ctx, keys)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"cluster_a": "1", "cluster_b": "2"}, res.Found)
+	assert.Equal(t, []string{"cluster_c"}, res.Missing)
+	assert.Nil(t, c.DeleteManyCtx(ctx, keys))
+	seen := map[string]bool{}
+	for _, cmd := range recorder.cmds {
+		switch cmd.Name() {
+		case "get", "set", "del":
+			seen[cmd.Name()] = true
+		case "mget", "mset":
+			t.Errorf("multi key %s sent to the cluster: %v", cmd.Name(), cmd.Args())
+		}
+		if cmd.Name() == "del" {
+			assert.Len(t, cmd.Args(), 2)
+		}
+	}
+	assert.Equal(t, map[string]bool{"get": true, "set": true, "del": true}, seen)
+	n, err := c.DeletePatternCtx(ctx, "cluster_*")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
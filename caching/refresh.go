@@ -0,0 +1,158 @@
+package caching
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RefreshOptions configures GetOrRefresh
+// params:
+//   - TTL: how long a loaded value is considered fresh
+//   - StaleTTL: how long after TTL the stale value is still served while it is refreshed in the background
+//   - Beta: XFetch early expiration factor, values above 0 make refreshes start probabilistically
+//     before TTL elapses (1 is the usual choice, larger values refresh earlier), 0 disables it
+type RefreshOptions struct {
+	TTL      time.Duration
+	StaleTTL time.Duration
+	Beta     float64
+}
+
+// staleEntry wraps a value with the metadata needed for stale-while-revalidate,
+// byte values are kept in Bytes so they come back as bytes once encoded as JSON
+type staleEntry struct {
+	Value      interface{} `json:"v,omitempty"`
+	Bytes      []byte      `json:"b,omitempty"`
+	FreshUntil int64       `json:"f"`
+	Delta      int64       `json:"d"`
+}
+
+// GetOrRefresh returns the value for the given key, loading it on a miss.
+// Once the value is older than TTL it keeps being served for StaleTTL while a single
+// background refresh runs, with Beta > 0 the refresh may start before TTL (XFetch).
+// Keys written through GetOrRefresh carry metadata and should only be read through it.
+// Outside of memory caches values are stored as JSON and come back as decoded JSON,
+// byte values excepted, use Store.GetOrRefresh to get the loader's type on every backend.
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - opts:*RefreshOptions => refresh options
+//   - loader:LoaderFn => function computing the value
+//
+// returns:
+//   - interface{}: value
+//   - error: error if any
+func (c *cacheImpl) GetOrRefresh(
+	ctx context.Context,
+	key string,
+	opts *RefreshOptions,
+	loader LoaderFn,
+) (interface{}, error) {
+	if opts == nil {
+		opts = &RefreshOptions{}
+	}
+	raw, err := c.GetCtx(ctx, key)
+	if err != nil {
+		if !isMiss(err) && err != Err_CACHE_UNAVAILABLE {
+			c.lgr.Warn("[Cache] Loading through cache failure", zap.String("key", key), zap.Error(err))
+		}
+		v, err, _ := c.flights.Do(c.key(key), func() (interface{}, error) {
+			return c.refresh(ctx, key, opts, loader)
+		})
+		return v, err
+	}
+	entry, ok := decodeStaleEntry(raw)
+	if !ok {
+		return nil, Err_UNEXPECTED_VALUE_TYPE
+	}
+	if shouldRefresh(entry, opts.Beta, time.Now()) {
+		c.flights.Go("refresh:"+c.key(key), func() (interface{}, error) {
+			return c.refresh(context.WithoutCancel(ctx), key, opts, loader)
+		})
+	}
+	return entry.Value, nil
+}
+
+// refresh calls the loader and stores the wrapped result
+func (c *cacheImpl) refresh(
+	ctx context.Context,
+	key string,
+	opts *RefreshOptions,
+	loader LoaderFn,
+) (interface{}, error) {
+	start := time.Now()
+	v, err := loader(ctx)
+	if err != nil {
+		c.lgr.Error("[Cache] Error refreshing value", zap.String("key", key), zap.Error(err))
+		return nil, err
+	}
+	end := time.Now()
+	entry := staleEntry{
+		Value:      v,
+		FreshUntil: end.Add(opts.TTL).UnixMilli(),
+		Delta:      end.Sub(start).Milliseconds(),
+	}
+	var stored interface{} = entry
+	// only the memory store keeps values as they are, layers need bytes
+	if c.typ != MEMORY_CACHE_TYPE || c.layers != nil {
+		if b, ok := v.([]byte); ok {
+			entry.Value, entry.Bytes = nil, b
+		}
+		byts, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		stored = byts
+	}
+	ttl := opts.TTL + opts.StaleTTL
+	if ttl > 0 {
+		err = c.SetWithExpirationCtx(ctx, key, stored, ttl)
+	} else {
+		err = c.SetCtx(ctx, key, stored)
+	}
+	if err != nil && err != Err_CACHE_UNAVAILABLE {
+		c.lgr.Warn("[Cache] Error storing refreshed value", zap.String("key", key), zap.Error(err))
+	}
+	return v, nil
+}
+
+// shouldRefresh reports whether the entry is stale or, with XFetch enabled,
+// whether it was randomly picked for an early refresh
+func shouldRefresh(entry staleEntry, beta float64, now time.Time) bool {
+	nowMs := now.UnixMilli()
+	if nowMs >= entry.FreshUntil {
+		return true
+	}
+	if beta <= 0 || entry.Delta <= 0 {
+		return false
+	}
+	// XFetch: now - delta * beta * ln(rand) >= expiry
+	gap := float64(entry.Delta) * beta * -math.Log(1-rand.Float64())
+	return float64(nowMs)+gap >= float64(entry.FreshUntil)
+}
+
+func decodeStaleEntry(raw interface{}) (staleEntry, bool) {
+	var entry staleEntry
+	var data []byte
+	switch v := raw.(type) {
+	case staleEntry:
+		return v, true
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, false
+	}
+	if entry.Bytes != nil {
+		entry.Value = entry.Bytes
+	}
+	return entry, true
+}
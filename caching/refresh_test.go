@@ -0,0 +1,118 @@
+package caching
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrRefreshServesStale(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute)
+	var calls int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return n, nil
+	}
+	opts := &RefreshOptions{TTL: 50 * time.Millisecond, StaleTTL: time.Minute}
+	val, err := c.GetOrRefresh(context.Background(), "test", opts, loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), val)
+	// still fresh, no refresh
+	val, err = c.GetOrRefresh(context.Background(), "test", opts, loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), val)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	time.Sleep(60 * time.Millisecond)
+	// stale, the old value is served while the refresh runs
+	val, err = c.GetOrRefresh(context.Background(), "test", opts, loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), val)
+	assert.Eventually(t, func() bool {
+		val, err := c.GetOrRefresh(context.Background(), "test", opts, loader)
+		return err == nil && val == int32(2)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestShouldRefresh(t *testing.T) {
+	now := time.Now()
+	fresh := staleEntry{FreshUntil: now.Add(time.Minute).UnixMilli(), Delta: 10}
+	assert.False(t, shouldRefresh(fresh, 0, now))
+	assert.False(t, shouldRefresh(fresh, 1, now))
+	assert.True(t, shouldRefresh(fresh, 0, now.Add(2*time.Minute)))
+	// a huge beta makes an early refresh all but certain
+	assert.True(t, shouldRefresh(fresh, 1e9, now))
+}
+
+func TestGetOrRefreshRedis(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Delete("refresh_test"))
+	opts := &RefreshOptions{TTL: time.Minute, StaleTTL: time.Minute, Beta: 1}
+	val, err := c.GetOrRefresh(context.Background(), "refresh_test", opts,
+		func(ctx context.Context) (interface{}, error) {
+			return "loaded", nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded", val)
+	val, err = c.GetOrRefresh(context.Background(), "refresh_test", opts,
+		func(ctx context.Context) (interface{}, error) {
+			return "reloaded", nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded", val)
+}
+
+func TestStoreGetOrRefreshKeepsType(t *testing.T) {
+	type profile struct {
+		Name  string
+		Score int
+		Tags  []string
+	}
+	redisUri := testRedisURI(t)
+	redisCache, err := InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	defer redisCache.Close()
+	two, err := InitTwoTierCache(redisUri, nil)
+	assert.Nil(t, err)
+	defer two.Close()
+	disk := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+	want := profile{Name: "jane", Score: 7, Tags: []string{"a"}}
+	opts := &RefreshOptions{TTL: time.Minute, StaleTTL: time.Minute}
+	for name, c := range map[string]Cache{
+		"memory":   InitMemoryCache(time.Minute, time.Minute),
+		"redis":    redisCache.WithName("refresh_type"),
+		"two_tier": two.WithName("refresh_type_two_tier"),
+		"disk":     disk,
+		"layers":   InitMemoryCache(time.Minute, time.Minute).WithEncryption(testKeyring(t)),
+	} {
+		s := NewStore[profile](c, nil)
+		var calls int32
+		loader := func(ctx context.Context) (profile, error) {
+			atomic.AddInt32(&calls, 1)
+			return want, nil
+		}
+		// the loaded value and the cached one have the loader's type
+		for i := 0; i < 2; i++ {
+			got, err := s.GetOrRefresh(context.Background(), "user", opts, loader)
+			assert.Nil(t, err, name)
+			assert.Equal(t, want, got, name)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls), name)
+		assert.Nil(t, c.Delete("user"))
+	}
+
+	// byte values come back as bytes outside of memory
+	v, err := redisCache.GetOrRefresh(context.Background(), "refresh_bytes", opts,
+		func(ctx context.Context) (interface{}, error) { return []byte{0xff, 1}, nil })
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xff, 1}, v)
+	v, err = redisCache.GetOrRefresh(context.Background(), "refresh_bytes", opts, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xff, 1}, v)
+	assert.Nil(t, redisCache.Delete("refresh_bytes"))
+}
@@ -0,0 +1,178 @@
+package caching
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const default_scan_batch = 100
+
+// KeyIterator streams the keys matching a pattern
+// on redis the same key may be returned more than once if the keyspace changes while iterating
+type KeyIterator interface {
+	// Next advances the iterator, it returns false once the keys are exhausted or an error occurred
+	Next(ctx context.Context) bool
+	// Key returns the current key
+	Key() string
+	// Err returns the error that stopped the iteration, if any
+	Err() error
+}
+
+// ScanCtx returns an iterator over the keys matching the glob pattern
+// redis is walked with SCAN cursors, memory keys are matched with the same glob semantics
+// named caches only walk their own keys and return them without the namespace
+// params:
+//   - ctx: context
+//   - pattern:string => glob pattern, an empty pattern matches every key
+//   - batch:int64 => number of keys fetched per round trip, defaults to 100
+//
+// returns:
+//   - KeyIterator: key iterator
+func (c *cacheImpl) ScanCtx(ctx context.Context, pattern string, batch int64) KeyIterator {
+	if pattern == "" {
+		pattern = "*"
+	}
+	if batch <= 0 {
+		batch = default_scan_batch
+	}
+	it := c.scan(c.pattern(pattern), batch)
+	if c.prefix == "" {
+		return it
+	}
+	return &namespacedIterator{KeyIterator: it, c: c}
+}
+
+// scan returns an iterator over the stored keys matching the pattern
+func (c *cacheImpl) scan(pattern string, batch int64) KeyIterator {
+	switch c.typ {
+	case REDIS_CACHE_TYPE, TWO_TIER_CACHE_TYPE:
+		return &redisKeyIterator{c: c, pattern: pattern, batch: batch}
+	case DISK_CACHE_TYPE:
+		return &diskKeyIterator{c: c, pattern: pattern, batch: batch}
+	default:
+		return &memKeyIterator{c: c, pattern: pattern}
+	}
+}
+
+// DeletePattern deletes every key matching the glob pattern
+// params:
+//   - pattern:string => glob pattern
+//
+// returns:
+//   - int: number of deleted keys
+//   - error: error if any
+func (c *cacheImpl) DeletePattern(pattern string) (int, error) {
+	return c.DeletePatternCtx(context.TODO(), pattern)
+}
+
+// DeletePatternCtx deletes every key matching the glob pattern
+// params:
+//   - ctx: context
+//   - pattern:string => glob pattern
+//
+// returns:
+//   - int: number of deleted keys
+//   - error: error if any
+func (c *cacheImpl) DeletePatternCtx(ctx context.Context, pattern string) (int, error) {
+	now := time.Now()
+	deleted := 0
+	batch := make([]string, 0, default_scan_batch)
+	var err error
+	it := c.ScanCtx(ctx, pattern, default_scan_batch)
+	for it.Next(ctx) {
+		batch = append(batch, it.Key())
+		if len(batch) < default_scan_batch {
+			continue
+		}
+		if err = c.DeleteManyCtx(ctx, batch); err != nil {
+			break
+		}
+		deleted += len(batch)
+		batch = batch[:0]
+	}
+	if err == nil {
+		err = it.Err()
+	}
+	if err == nil && len(batch) > 0 {
+		if err = c.DeleteManyCtx(ctx, batch); err == nil {
+			deleted += len(batch)
+		}
+	}
+	c.observe(ctx, "DELPATTERN", now, time.Now(), err, map[string]string{
+		"pattern": pattern,
+		"deleted": strconv.Itoa(deleted),
+	})
+	return deleted, err
+}
+
+type redisKeyIterator struct {
+	c       *cacheImpl
+	pattern string
+	batch   int64
+	nodes   []redis.Cmdable
+	cursor  uint64
+	started bool
+	buf     []string
+	key     string
+	err     error
+}
+
+// Next walks the SCAN cursor of each node in turn, a cluster has one node per master
+func (it *redisKeyIterator) Next(ctx context.Context) bool {
+	if it.nodes == nil && it.err == nil {
+		if it.err = it.c.available(); it.err == nil {
+			it.nodes, it.err = it.c.scanNodes(ctx)
+		}
+	}
+	for len(it.buf) == 0 {
+		if it.err != nil || len(it.nodes) == 0 {
+			return false
+		}
+		if it.started && it.cursor == 0 {
+			it.nodes = it.nodes[1:]
+			it.started = false
+			continue
+		}
+		it.started = true
+		it.buf, it.cursor, it.err = it.nodes[0].Scan(ctx, it.cursor, it.pattern, it.batch).Result()
+	}
+	it.key = it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+func (it *redisKeyIterator) Key() string { return it.key }
+
+func (it *redisKeyIterator) Err() error { return it.err }
+
+type memKeyIterator struct {
+	c       *cacheImpl
+	pattern string
+	keys    []string
+	started bool
+	key     string
+}
+
+func (it *memKeyIterator) Next(ctx context.Context) bool {
+	if !it.started {
+		it.started = true
+		for _, key := range it.c.mem.Keys() {
+			if matchGlob(it.pattern, key) {
+				it.keys = append(it.keys, key)
+			}
+		}
+	}
+	if len(it.keys) == 0 {
+		return false
+	}
+	it.key = it.keys[0]
+	it.keys = it.keys[1:]
+	return true
+}
+
+func (it *memKeyIterator) Key() string { return it.key }
+
+func (it *memKeyIterator) Err() error { return nil }
@@ -0,0 +1,91 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"*", "anything", true},
+		{"*", "", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users:1", false},
+		{"user:*:name", "user:1:name", true},
+		{"user:*:name", "user:1:age", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"*a*b", "xxaxxb", true},
+		{"*a*b", "xxaxxbc", false},
+		{"a/*", "a/b/c", true},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.match, matchGlob(tc.pattern, tc.str), "%s ~ %s", tc.pattern, tc.str)
+	}
+}
+
+func testScan(t *testing.T, c Cache, prefix string) {
+	ctx := context.Background()
+	items := map[string]interface{}{}
+	expected := []string{}
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("%suser:%d", prefix, i)
+		items[key] = "value"
+		expected = append(expected, key)
+	}
+	items[prefix+"order:1"] = "value"
+	assert.Nil(t, c.SetManyCtx(ctx, items, time.Minute))
+	keys := []string{}
+	it := c.ScanCtx(ctx, prefix+"user:*", 10)
+	for it.Next(ctx) {
+		keys = append(keys, it.Key())
+	}
+	assert.Nil(t, it.Err())
+	sort.Strings(keys)
+	sort.Strings(expected)
+	assert.Equal(t, expected, keys)
+	keys, err := c.KeysCtx(ctx, prefix+"user:*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, expected, keys)
+	deleted, err := c.DeletePatternCtx(ctx, prefix+"user:*")
+	assert.Nil(t, err)
+	assert.Equal(t, 25, deleted)
+	keys, err = c.KeysCtx(ctx, prefix+"*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{prefix + "order:1"}, keys)
+}
+
+func TestKeysMemorySubstring(t *testing.T) {
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.Set("user:1", "a"))
+	assert.Nil(t, c.Set("admin_user", "b"))
+	assert.Nil(t, c.Set("order:1", "c"))
+	// patterns without glob characters keep matching substrings
+	keys, err := c.Keys("user")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"user:1", "admin_user"}, keys)
+	keys, err = c.Keys("user*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1"}, keys)
+	// scans and pattern deletes only take globs
+	deleted, err := c.DeletePattern("user")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, deleted)
+}
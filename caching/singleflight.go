@@ -0,0 +1,86 @@
+package caching
+
+import "sync"
+
+// flightCall is an in-flight or completed call of a flightGroup
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// flightGroup collapses concurrent calls sharing the same key into a single execution
+type flightGroup struct {
+	mtx   sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: make(map[string]*flightCall),
+	}
+}
+
+// Do executes fn once for all concurrent callers of the same key
+// params:
+//   - key: key identifying the call
+//   - fn: function to execute
+//
+// returns:
+//   - interface{}: result of fn
+//   - error: error returned by fn
+//   - bool: true if the result was shared with other callers
+func (g *flightGroup) Do(
+	key string,
+	fn func() (interface{}, error),
+) (interface{}, error, bool) {
+	g.mtx.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mtx.Unlock()
+		call.wg.Wait()
+		return call.val, call.err, true
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mtx.Unlock()
+
+	defer func() {
+		g.mtx.Lock()
+		delete(g.calls, key)
+		g.mtx.Unlock()
+		call.wg.Done()
+	}()
+	call.val, call.err = fn()
+	return call.val, call.err, false
+}
+
+// Go starts fn in the background unless a call for the same key is already in flight
+// params:
+//   - key: key identifying the call
+//   - fn: function to execute
+//
+// returns:
+//   - bool: true if a new call was started
+func (g *flightGroup) Go(key string, fn func() (interface{}, error)) bool {
+	g.mtx.Lock()
+	if _, ok := g.calls[key]; ok {
+		g.mtx.Unlock()
+		return false
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mtx.Unlock()
+
+	go func() {
+		defer func() {
+			g.mtx.Lock()
+			delete(g.calls, key)
+			g.mtx.Unlock()
+			call.wg.Done()
+		}()
+		call.val, call.err = fn()
+	}()
+	return true
+}
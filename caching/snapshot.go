@@ -0,0 +1,306 @@
+package caching
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	Err_INVALID_SNAPSHOT       = fmt.Errorf("invalid cache snapshot")
+	Err_EXPORT_NEEDS_NAMESPACE = fmt.Errorf("exporting redis needs a named cache or a pattern")
+)
+
+// snapshotEntry is one line of a snapshot, the value is kept as text when it is
+// valid utf-8 and base64 encoded otherwise, TTL is the remaining lifetime in milliseconds
+type snapshotEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Binary []byte `json:"binary,omitempty"`
+	TTL    int64  `json:"ttl,omitempty"`
+}
+
+// emitFn writes an entry of the cache to a snapshot, key is the stored key
+type emitFn func(key string, value interface{}, ttl time.Duration) error
+
+// Export writes every live entry of the cache with its remaining TTL to w as JSON lines
+// keys are written without the namespace so the snapshot can be imported under another name,
+// values are written the way redis stores them, values redis can't encode are written as JSON,
+// compressed and encrypted values are written decoded so Import can seal them again under
+// their new key, snapshots of encrypted caches hold the plain values, tags are not exported
+// an unnamed redis cache would dump the whole database, it needs ExportPattern instead
+// params:
+//   - ctx: context
+//   - w:io.Writer => destination of the snapshot
+//
+// returns:
+//   - int: number of exported entries
+//   - error: Err_EXPORT_NEEDS_NAMESPACE for unnamed redis and two tier caches, or the first error
+func (c *cacheImpl) Export(ctx context.Context, w io.Writer) (int, error) {
+	return c.ExportPattern(ctx, w, "")
+}
+
+// ExportPattern writes the live entries matching pattern like Export does
+// params:
+//   - ctx: context
+//   - w:io.Writer => destination of the snapshot
+//   - pattern: redis glob matched within the namespace, empty matches the whole namespace
+//
+// returns:
+//   - int: number of exported entries
+//   - error: Err_EXPORT_NEEDS_NAMESPACE when pattern is empty on an unnamed redis or two tier cache
+func (c *cacheImpl) ExportPattern(ctx context.Context, w io.Writer, pattern string) (int, error) {
+	remote := c.typ == REDIS_CACHE_TYPE || c.typ == TWO_TIER_CACHE_TYPE
+	if remote && c.prefix == "" && pattern == "" {
+		return 0, Err_EXPORT_NEEDS_NAMESPACE
+	}
+	glob := c.pattern(pattern)
+	if glob == "" {
+		glob = "*"
+	}
+	now := time.Now()
+	enc := json.NewEncoder(w)
+	n := 0
+	emit := func(key string, value interface{}, ttl time.Duration) error {
+		value, err := c.decode(key, value)
+		if err != nil {
+			return err
+		}
+		entry, err := newSnapshotEntry(c.unkey(key), value, ttl)
+		if err != nil {
+			return err
+		}
+		if err = enc.Encode(entry); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+	var err error
+	switch c.typ {
+	case REDIS_CACHE_TYPE, TWO_TIER_CACHE_TYPE:
+		err = c.exportRedisCache(ctx, glob, emit)
+	case MEMORY_CACHE_TYPE:
+		err = c.exportMemcache(glob, emit)
+	case DISK_CACHE_TYPE:
+		err = c.exportDiskCache(ctx, glob, emit)
+	}
+	c.observe(ctx, "EXPORT", now, time.Now(), err, map[string]string{
+		"entries": strconv.Itoa(n),
+	})
+	return n, err
+}
+
+// Import reads a snapshot written by Export and stores its entries in the cache
+// entries keep their remaining TTL counted from the import, entries exported without
+// expiration get the backend default, values go through the compression and encryption
+// of the cache like any write
+// params:
+//   - ctx: context
+//   - r:io.Reader => snapshot
+//
+// returns:
+//   - int: number of imported entries
+//   - error: Err_INVALID_SNAPSHOT when the snapshot can't be decoded, or the first write error
+func (c *cacheImpl) Import(ctx context.Context, r io.Reader) (int, error) {
+	now := time.Now()
+	dec := json.NewDecoder(r)
+	n := 0
+	var err error
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var entry snapshotEntry
+		if err = dec.Decode(&entry); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			err = fmt.Errorf("%w: %v", Err_INVALID_SNAPSHOT, err)
+			break
+		}
+		if entry.Key == "" || entry.TTL < 0 {
+			err = Err_INVALID_SNAPSHOT
+			break
+		}
+		var value interface{} = entry.Value
+		if entry.Binary != nil {
+			value = entry.Binary
+		}
+		ttl := time.Duration(entry.TTL) * time.Millisecond
+		if err = c.SetWithExpirationCtx(ctx, entry.Key, value, ttl); err == nil {
+			n++
+		}
+	}
+	c.observe(ctx, "IMPORT", now, time.Now(), err, map[string]string{
+		"entries": strconv.Itoa(n),
+	})
+	return n, err
+}
+
+func newSnapshotEntry(key string, value interface{}, ttl time.Duration) (snapshotEntry, error) {
+	entry := snapshotEntry{Key: key}
+	if ttl > 0 {
+		entry.TTL = ttl.Milliseconds()
+		if entry.TTL == 0 {
+			entry.TTL = 1
+		}
+	}
+	byts, err := encodeDiskValue(value)
+	if err != nil {
+		if byts, err = json.Marshal(value); err != nil {
+			return entry, err
+		}
+	}
+	if utf8.Valid(byts) {
+		entry.Value = string(byts)
+	} else {
+		entry.Binary = byts
+	}
+	return entry, nil
+}
+
+// isInternalKey reports whether a stored key belongs to the bookkeeping of the package
+// such as tag sets and locks, they are left out of snapshots
+func isInternalKey(key string) bool {
+	return strings.HasPrefix(key, tag_key_prefix) ||
+		strings.HasPrefix(key, load_lock_prefix) ||
+		strings.HasPrefix(key, "lock:{")
+}
+
+// ===============================================================================	Redis	Cache	=========================================================================
+func (c *cacheImpl) exportRedisCache(ctx context.Context, glob string, emit emitFn) error {
+	if err := c.available(); err != nil {
+		return err
+	}
+	it := c.scan(glob, default_scan_batch)
+	batch := make([]string, 0, default_scan_batch)
+	for it.Next(ctx) {
+		if key := it.Key(); !isInternalKey(key) {
+			batch = append(batch, key)
+		}
+		if len(batch) == cap(batch) {
+			if err := c.exportRedisBatch(ctx, batch, emit); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return c.exportRedisBatch(ctx, batch, emit)
+}
+
+// exportRedisBatch reads the values and ttls of a batch of keys in one round trip,
+// keys that expired since the scan or do not hold strings are skipped
+func (c *cacheImpl) exportRedisBatch(ctx context.Context, keys []string, emit emitFn) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := c.redis.Pipeline()
+	values := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		values[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	// per command errors are read below
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil && !isWrongType(err) {
+		return err
+	}
+	for i, key := range keys {
+		value, err := values[i].Result()
+		if err == redis.Nil || isWrongType(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		ttl, err := ttls[i].Result()
+		if err != nil {
+			return err
+		}
+		// -2 means the key expired in between, -1 that it has no expiration
+		if ttl == -2 {
+			continue
+		} else if ttl < 0 {
+			ttl = 0
+		}
+		if err = emit(key, value, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// ===============================================================================	Memory	Cache	=========================================================================
+func (c *cacheImpl) exportMemcache(glob string, emit emitFn) error {
+	now := time.Now().UnixNano()
+	items := c.mem.Items()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		if matchGlob(glob, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		item := items[key]
+		ttl := time.Duration(0)
+		if item.Expiration > 0 {
+			if ttl = time.Duration(item.Expiration - now); ttl <= 0 {
+				continue
+			}
+		}
+		if err := emit(key, item.Object, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ===============================================================================	Disk	Cache	=========================================================================
+func (c *cacheImpl) exportDiskCache(ctx context.Context, glob string, emit emitFn) error {
+	now := time.Now().UnixNano()
+	rows, err := c.disk.db.QueryContext(
+		ctx,
+		`SELECT key, value, expires_at FROM cache_entries
+		WHERE expires_at = 0 OR expires_at > ? ORDER BY key`,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value []byte
+		var expiresAt int64
+		if err = rows.Scan(&key, &value, &expiresAt); err != nil {
+			return err
+		}
+		if !matchGlob(glob, key) {
+			continue
+		}
+		ttl := time.Duration(0)
+		if expiresAt > 0 {
+			ttl = time.Duration(expiresAt - now)
+		}
+		if err = emit(key, value, ttl); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,176 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSnapshot exports a namespace of src and imports it into another namespace of dst
+func testSnapshot(t *testing.T, src Cache, dst Cache, prefix string) {
+	ctx := context.Background()
+	from := src.WithName(prefix + "from")
+	to := dst.WithName(prefix + "to")
+	_, err := from.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+	_, err = to.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+
+	assert.Nil(t, from.SetWithExpirationCtx(ctx, "short", "a", time.Minute))
+	assert.Nil(t, from.SetWithExpirationCtx(ctx, "long", 42, time.Hour))
+	assert.Nil(t, from.SetWithExpirationCtx(ctx, "binary", []byte{0xff, 0x00, 0xfe}, time.Hour))
+	assert.Nil(t, src.SetCtx(ctx, prefix+"outside", "skipped"))
+	// tag sets are not entries and are left out
+	assert.Nil(t, from.SetWithTagsCtx(ctx, "tagged", "v", time.Minute, "tag"))
+	assert.Nil(t, from.DeleteCtx(ctx, "tagged"))
+
+	buf := &bytes.Buffer{}
+	n, err := from.Export(ctx, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+	assert.NotContains(t, buf.String(), "outside")
+
+	n, err = to.Import(ctx, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	keys, err := to.KeysCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"short", "long", "binary"}, keys)
+	v, err := to.GetCtx(ctx, "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", v)
+	v, err = to.GetCtx(ctx, "long")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", toString(v))
+	v, err = to.GetCtx(ctx, "binary")
+	assert.Nil(t, err)
+	assert.Equal(t, string([]byte{0xff, 0x00, 0xfe}), toString(v))
+
+	// the remaining ttls travel with the entries
+	buf.Reset()
+	_, err = to.Export(ctx, buf)
+	assert.Nil(t, err)
+	entries := map[string]snapshotEntry{}
+	for _, e := range decodeSnapshot(t, buf) {
+		entries[e.Key] = e
+	}
+	assert.InDelta(t, time.Minute.Milliseconds(), entries["short"].TTL, 5000)
+	assert.InDelta(t, time.Hour.Milliseconds(), entries["long"].TTL, 5000)
+
+	_, err = from.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+	_, err = to.DeletePatternCtx(ctx, "*")
+	assert.Nil(t, err)
+	assert.Nil(t, src.DeleteCtx(ctx, prefix+"outside"))
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	b, _ := encodeDiskValue(v)
+	return string(b)
+}
+
+func decodeSnapshot(t *testing.T, r io.Reader) []snapshotEntry {
+	entries := []snapshotEntry{}
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var e snapshotEntry
+		assert.Nil(t, dec.Decode(&e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestImportValidatesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	n, err := c.Import(ctx, strings.NewReader(`{"key":"a","value":"1"}`+"\n"+`{"key":`))
+	assert.ErrorIs(t, err, Err_INVALID_SNAPSHOT)
+	assert.Equal(t, 1, n)
+	_, err = c.Import(ctx, strings.NewReader(`{"value":"1"}`))
+	assert.Equal(t, Err_INVALID_SNAPSHOT, err)
+	// entries without ttl get the backend default
+	n, err = c.Import(ctx, strings.NewReader(`{"key":"b","value":"2"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	v, err := c.GetCtx(ctx, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", v)
+}
+
+func TestExportSkipsExpired(t *testing.T) {
+	ctx := context.Background()
+	c, err := InitBoundedMemoryCache(&BoundedMemoryOptions{MaxEntries: 10})
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Nil(t, c.SetWithExpirationCtx(ctx, "gone", "v", time.Millisecond))
+	assert.Nil(t, c.SetCtx(ctx, "kept", map[string]int{"a": 1}))
+	time.Sleep(5 * time.Millisecond)
+	buf := &bytes.Buffer{}
+	n, err := c.Export(ctx, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	// values redis can't encode are exported as json
+	assert.JSONEq(t, `{"key":"kept","value":"{\"a\":1}"}`, buf.String())
+}
+
+func TestExportPattern(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	defer c.Close()
+	two, err := InitTwoTierCache(redisUri, nil)
+	assert.Nil(t, err)
+	defer two.Close()
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	// an unnamed redis cache would dump the whole database
+	for _, unnamed := range []Cache{c, two} {
+		n, err := unnamed.Export(ctx, buf)
+		assert.Equal(t, Err_EXPORT_NEEDS_NAMESPACE, err)
+		assert.Equal(t, 0, n)
+	}
+	assert.Equal(t, 0, buf.Len())
+
+	assert.Nil(t, c.SetCtx(ctx, "export_pattern:a", "1"))
+	assert.Nil(t, c.SetCtx(ctx, "export_pattern:b", "2"))
+	assert.Nil(t, c.SetCtx(ctx, "export_other", "3"))
+	n, err := c.ExportPattern(ctx, buf, "export_pattern:*")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.NotContains(t, buf.String(), "export_other")
+	_, err = c.DeletePatternCtx(ctx, "export_*")
+	assert.Nil(t, err)
+
+	// patterns are matched within the namespace on every backend
+	disk := initTestDiskCache(t, filepath.Join(t.TempDir(), "cache.db"), nil)
+	for _, backend := range []Cache{c, InitMemoryCache(time.Minute, time.Minute), disk} {
+		named := backend.WithName("export_pattern")
+		assert.Nil(t, named.SetCtx(ctx, "user:1", "a"))
+		assert.Nil(t, named.SetCtx(ctx, "order:1", "b"))
+		assert.Nil(t, backend.SetCtx(ctx, "user:2", "outside"))
+		buf.Reset()
+		n, err = named.ExportPattern(ctx, buf, "user:*")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		entries := decodeSnapshot(t, buf)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "user:1", entries[0].Key)
+		_, err = named.DeletePatternCtx(ctx, "*")
+		assert.Nil(t, err)
+		assert.Nil(t, backend.DeleteCtx(ctx, "user:2"))
+	}
+}
@@ -0,0 +1,240 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var Err_UNEXPECTED_VALUE_TYPE = fmt.Errorf("unexpected value type in cache")
+
+// Store is the type-safe successor of Cache.
+// Values are encoded with a Codec before they reach the backend, so Get
+// returns the same V regardless of whether the data lives in memory or redis.
+type Store[V any] interface {
+	Get(key string) (V, error)
+	GetCtx(ctx context.Context, key string) (V, error)
+	Set(key string, value V) error
+	SetCtx(ctx context.Context, key string, value V) error
+	SetWithExpiration(key string, value V, expiration time.Duration) error
+	SetWithExpirationCtx(
+		ctx context.Context,
+		key string,
+		value V,
+		expiration time.Duration,
+	) error
+	Delete(key string) error
+	DeleteCtx(ctx context.Context, key string) error
+	Keys(pattern string) ([]string, error)
+	KeysCtx(ctx context.Context, pattern string) ([]string, error)
+	// GetOrRefresh is Cache.GetOrRefresh returning V on every backend
+	GetOrRefresh(
+		ctx context.Context,
+		key string,
+		opts *RefreshOptions,
+		loader func(ctx context.Context) (V, error),
+	) (V, error)
+	// Cache returns the untyped cache backing the store
+	Cache() Cache
+}
+
+type storeImpl[V any] struct {
+	cache Cache
+	codec Codec
+}
+
+// NewStore adapts an existing Cache into a typed Store
+// params:
+//   - c: cache instance
+//   - codec: codec used to encode values, defaults to JSONCodec when nil
+//
+// returns:
+//   - Store[V]: store instance
+func NewStore[V any](c Cache, codec Codec) Store[V] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &storeImpl[V]{
+		cache: c,
+		codec: codec,
+	}
+}
+
+// NewRedisStore initializes a typed store backed by redis
+// params:
+//   - url: redis url
+//   - codec: codec used to encode values, defaults to JSONCodec when nil
+//
+// returns:
+//   - Store[V]: store instance
+//   - error: error if any
+func NewRedisStore[V any](url string, codec Codec) (Store[V], error) {
+	c, err := InitRedisCache(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore[V](c, codec), nil
+}
+
+// NewMemoryStore initializes a typed store backed by an in-memory cache
+// params:
+//   - expiration: expiration time
+//   - cleanupInterval: cleanup interval
+//   - codec: codec used to encode values, defaults to JSONCodec when nil
+//
+// returns:
+//   - Store[V]: store instance
+func NewMemoryStore[V any](
+	expiration time.Duration,
+	cleanupInterval time.Duration,
+	codec Codec,
+) Store[V] {
+	return NewStore[V](InitMemoryCache(expiration, cleanupInterval), codec)
+}
+
+func (s *storeImpl[V]) Cache() Cache {
+	return s.cache
+}
+
+func (s *storeImpl[V]) Get(key string) (V, error) {
+	return s.GetCtx(context.TODO(), key)
+}
+
+// GetCtx returns the decoded value for the given key
+// params:
+//   - ctx: context
+//   - key:string => key
+//
+// returns:
+//   - V: value
+//   - error: error if any
+func (s *storeImpl[V]) GetCtx(ctx context.Context, key string) (V, error) {
+	var res V
+	raw, err := s.cache.GetCtx(ctx, key)
+	if err != nil {
+		return res, err
+	}
+	return s.decode(raw)
+}
+
+func (s *storeImpl[V]) Set(key string, value V) error {
+	return s.SetCtx(context.TODO(), key, value)
+}
+
+// SetCtx encodes and sets the value for the given key
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - value:V => value
+//
+// returns:
+//   - error: error if any
+func (s *storeImpl[V]) SetCtx(ctx context.Context, key string, value V) error {
+	byts, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.cache.SetCtx(ctx, key, byts)
+}
+
+func (s *storeImpl[V]) SetWithExpiration(
+	key string,
+	value V,
+	expiration time.Duration,
+) error {
+	return s.SetWithExpirationCtx(context.TODO(), key, value, expiration)
+}
+
+// SetWithExpirationCtx encodes and sets the value for the given key with expiration
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - value:V => value
+//   - expiration:time.Duration => expiration
+//
+// returns:
+//   - error: error if any
+func (s *storeImpl[V]) SetWithExpirationCtx(
+	ctx context.Context,
+	key string,
+	value V,
+	expiration time.Duration,
+) error {
+	byts, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.cache.SetWithExpirationCtx(ctx, key, byts, expiration)
+}
+
+func (s *storeImpl[V]) Delete(key string) error {
+	return s.cache.Delete(key)
+}
+
+func (s *storeImpl[V]) DeleteCtx(ctx context.Context, key string) error {
+	return s.cache.DeleteCtx(ctx, key)
+}
+
+func (s *storeImpl[V]) Keys(pattern string) ([]string, error) {
+	return s.cache.Keys(pattern)
+}
+
+func (s *storeImpl[V]) KeysCtx(ctx context.Context, pattern string) ([]string, error) {
+	return s.cache.KeysCtx(ctx, pattern)
+}
+
+// GetOrRefresh returns the value for the given key like Cache.GetOrRefresh, values are
+// encoded with the codec of the store so they are read back as V whatever the backend
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - opts:*RefreshOptions => refresh options
+//   - loader: function computing the value
+//
+// returns:
+//   - V: value
+//   - error: error if any
+func (s *storeImpl[V]) GetOrRefresh(
+	ctx context.Context,
+	key string,
+	opts *RefreshOptions,
+	loader func(ctx context.Context) (V, error),
+) (V, error) {
+	var res V
+	raw, err := s.cache.GetOrRefresh(ctx, key, opts, func(ctx context.Context) (interface{}, error) {
+		v, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.codec.Marshal(v)
+	})
+	if err != nil {
+		return res, err
+	}
+	return s.decode(raw)
+}
+
+// decode converts a raw backend value into V.
+// memory backends hand back the encoded []byte while redis hands back a string,
+// values written through the legacy Cache API as V are passed through as is.
+// a string the codec can't read is a legacy raw value when V is a string.
+func (s *storeImpl[V]) decode(raw interface{}) (V, error) {
+	var res V
+	switch v := raw.(type) {
+	case []byte:
+		err := s.codec.Unmarshal(v, &res)
+		return res, err
+	case string:
+		err := s.codec.Unmarshal([]byte(v), &res)
+		if err != nil {
+			if legacy, ok := raw.(V); ok {
+				return legacy, nil
+			}
+		}
+		return res, err
+	case V:
+		return v, nil
+	default:
+		return res, Err_UNEXPECTED_VALUE_TYPE
+	}
+}
@@ -0,0 +1,81 @@
+package caching
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type storeTestStruct struct {
+	Name string
+	Age  int
+}
+
+func TestStoreSetAndGet(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, GobCodec, MsgpackCodec} {
+		store := NewMemoryStore[storeTestStruct](time.Second*10, time.Second*10, codec)
+		err := store.Set("test", storeTestStruct{Name: "John Doe", Age: 20})
+		assert.Nil(t, err, codec.Name())
+		val, err := store.Get("test")
+		assert.Nil(t, err, codec.Name())
+		assert.Equal(t, storeTestStruct{Name: "John Doe", Age: 20}, val, codec.Name())
+	}
+}
+
+func TestStoreDefaultsToJSON(t *testing.T) {
+	store := NewMemoryStore[map[string]int](time.Second*10, time.Second*10, nil)
+	err := store.SetWithExpiration("test", map[string]int{"a": 1}, time.Second)
+	assert.Nil(t, err)
+	raw, err := store.Cache().Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"a":1}`), raw)
+}
+
+func TestStoreReadsLegacyValues(t *testing.T) {
+	c := InitMemoryCache(time.Second*10, time.Second*10)
+	err := c.Set("test", 42)
+	assert.Nil(t, err)
+	val, err := NewStore[int](c, nil).Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, 42, val)
+}
+
+func TestStoreReadsLegacyStrings(t *testing.T) {
+	c := InitMemoryCache(time.Second*10, time.Second*10)
+	assert.Nil(t, c.Set("legacy", "raw value"))
+	store := NewStore[string](c, nil)
+	val, err := store.Get("legacy")
+	assert.Nil(t, err)
+	assert.Equal(t, "raw value", val)
+	// values written through the store still go through the codec
+	assert.Nil(t, store.Set("encoded", "hello"))
+	val, err = store.Get("encoded")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", val)
+}
+
+func TestStoreUnexpectedValue(t *testing.T) {
+	c := InitMemoryCache(time.Second*10, time.Second*10)
+	err := c.Set("test", 42)
+	assert.Nil(t, err)
+	_, err = NewStore[string](c, nil).Get("test")
+	assert.Equal(t, Err_UNEXPECTED_VALUE_TYPE, err)
+}
+
+func TestStoreMissingKey(t *testing.T) {
+	store := NewMemoryStore[int](time.Second*10, time.Second*10, nil)
+	_, err := store.Get("missing")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+}
+
+func TestRedisStoreSetAndGet(t *testing.T) {
+	redisUri := testRedisURI(t)
+	store, err := NewRedisStore[storeTestStruct](redisUri, MsgpackCodec)
+	assert.Nil(t, err)
+	err = store.SetWithExpiration("store_test", storeTestStruct{Name: "John Doe", Age: 20}, time.Minute)
+	assert.Nil(t, err)
+	val, err := store.Get("store_test")
+	assert.Nil(t, err)
+	assert.Equal(t, storeTestStruct{Name: "John Doe", Age: 20}, val)
+}
@@ -0,0 +1,251 @@
+package caching
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	gc "github.com/patrickmn/go-cache"
+)
+
+const tag_key_prefix = "__tag:"
+
+// addTagScript adds a key to a tag set and keeps the set alive at least as long as the key
+// ARGV[1] is the key, ARGV[2] its ttl in milliseconds where 0 means no expiration
+var addTagScript = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+if ARGV[2] == "0" then
+	redis.call("PERSIST", KEYS[1])
+elseif ttl == -2 or (ttl >= 0 and ttl < tonumber(ARGV[2])) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// tagIndex tracks tag membership for memory caches, keys leave their tags when
+// they are deleted, expire or are evicted so the index does not outgrow the store
+type tagIndex struct {
+	mtx  sync.Mutex
+	tags map[string]map[string]struct{}
+	keys map[string]map[string]struct{}
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		tags: make(map[string]map[string]struct{}),
+		keys: make(map[string]map[string]struct{}),
+	}
+}
+
+func (t *tagIndex) add(key string, tags []string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, tag := range tags {
+		members, ok := t.tags[tag]
+		if !ok {
+			members = make(map[string]struct{})
+			t.tags[tag] = members
+		}
+		members[key] = struct{}{}
+		keyTags, ok := t.keys[key]
+		if !ok {
+			keyTags = make(map[string]struct{})
+			t.keys[key] = keyTags
+		}
+		keyTags[tag] = struct{}{}
+	}
+}
+
+func (t *tagIndex) pop(tag string) []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	members := t.tags[tag]
+	delete(t.tags, tag)
+	keys := make([]string, 0, len(members))
+	for k := range members {
+		keys = append(keys, k)
+		delete(t.keys[k], tag)
+		if len(t.keys[k]) == 0 {
+			delete(t.keys, k)
+		}
+	}
+	return keys
+}
+
+// remove detaches a key from all its tags, caches without an index ignore it
+func (t *tagIndex) remove(key string) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for tag := range t.keys[key] {
+		delete(t.tags[tag], key)
+		if len(t.tags[tag]) == 0 {
+			delete(t.tags, tag)
+		}
+	}
+	delete(t.keys, key)
+}
+
+// SetWithTagsCtx sets the value for the given key and attaches it to the given tags
+// params:
+//   - ctx: context
+//   - key:string => key
+//   - value:interface{} => value
+//   - expiration:time.Duration => expiration, 0 keeps the backend default
+//   - tags:...string => tags
+//
+// returns:
+//   - error: error if any
+func (c *cacheImpl) SetWithTagsCtx(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+	tags ...string,
+) error {
+	key = c.key(key)
+	tags = c.keysOf(tags)
+	value, err := c.encode(key, value)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	switch c.typ {
+	case REDIS_CACHE_TYPE:
+		err = c.setWithTagsRedisCache(ctx, key, value, expiration, tags)
+	case MEMORY_CACHE_TYPE:
+		err = c.setWithTagsMemcache(ctx, key, value, expiration, tags)
+	case TWO_TIER_CACHE_TYPE:
+		err = c.setWithTagsTwoTierCache(ctx, key, value, expiration, tags)
+	case DISK_CACHE_TYPE:
+		err = c.setWithTagsDiskCache(ctx, key, value, expiration, tags)
+	}
+	c.observe(ctx, "SETTAGS", now, time.Now(), err, map[string]string{
+		"key":        key,
+		"tags":       strings.Join(tags, ","),
+		"expiration": expiration.String(),
+	})
+	if err != nil {
+		return err
+	}
+	c.publishInvalidation(ctx, key)
+	return nil
+}
+
+// InvalidateTagCtx deletes every key attached to the given tag
+// params:
+//   - ctx: context
+//   - tag:string => tag
+//
+// returns:
+//   - error: error if any
+func (c *cacheImpl) InvalidateTagCtx(ctx context.Context, tag string) error {
+	tag = c.key(tag)
+	now := time.Now()
+	var keys []string
+	var err error
+	switch c.typ {
+	case REDIS_CACHE_TYPE, TWO_TIER_CACHE_TYPE:
+		keys, err = c.popRedisTag(ctx, tag)
+	case MEMORY_CACHE_TYPE:
+		keys = c.tags.pop(tag)
+	case DISK_CACHE_TYPE:
+		keys, err = c.popDiskTag(ctx, tag)
+	}
+	if err == nil && len(keys) > 0 {
+		// members are stored keys, DeleteManyCtx adds the namespace back
+		for i, key := range keys {
+			keys[i] = c.unkey(key)
+		}
+		err = c.DeleteManyCtx(ctx, keys)
+	}
+	c.observe(ctx, "INVALIDATETAG", now, time.Now(), err, map[string]string{
+		"tag":   tag,
+		"count": strconv.Itoa(len(keys)),
+	})
+	return err
+}
+
+// ===============================================================================	Redis	Cache	=========================================================================
+func (c *cacheImpl) setWithTagsRedisCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiry time.Duration,
+	tags []string,
+) error {
+	if err := c.available(); err != nil {
+		return err
+	}
+	ttl := "0"
+	if expiry > 0 {
+		ttl = strconv.FormatInt(expiry.Milliseconds(), 10)
+	}
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, expiry)
+		for _, tag := range tags {
+			addTagScript.Eval(ctx, pipe, []string{tag_key_prefix + tag}, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// popRedisTag atomically reads and removes a tag set
+func (c *cacheImpl) popRedisTag(ctx context.Context, tag string) ([]string, error) {
+	if err := c.available(); err != nil {
+		return nil, err
+	}
+	var members *redis.StringSliceCmd
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, tag_key_prefix+tag)
+		pipe.Del(ctx, tag_key_prefix+tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members.Val(), nil
+}
+
+// ===============================================================================	Memory	Cache	=========================================================================
+func (c *cacheImpl) setWithTagsMemcache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiry time.Duration,
+	tags []string,
+) error {
+	if expiry <= 0 {
+		expiry = gc.DefaultExpiration
+	}
+	c.mem.Set(key, value, expiry)
+	c.tags.add(key, tags)
+	return nil
+}
+
+// ===============================================================================	Two	Tier	Cache	=========================================================================
+func (c *cacheImpl) setWithTagsTwoTierCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiry time.Duration,
+	tags []string,
+) error {
+	if err := c.setWithTagsRedisCache(ctx, key, value, expiry, tags); err != nil {
+		c.deleteMem(key)
+		return err
+	}
+	ttl := c.l1TTL
+	if expiry > 0 && expiry < ttl {
+		ttl = expiry
+	}
+	c.setL1(key, value, ttl)
+	return nil
+}
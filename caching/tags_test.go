@@ -0,0 +1,69 @@
+package caching
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTags(t *testing.T, c Cache, prefix string) {
+	ctx := context.Background()
+	assert.Nil(t, c.SetWithTagsCtx(ctx, prefix+"a", "a", time.Minute, "tenant:1"))
+	assert.Nil(t, c.SetWithTagsCtx(ctx, prefix+"b", "b", time.Minute, "tenant:1", "order:2"))
+	assert.Nil(t, c.SetWithTagsCtx(ctx, prefix+"c", "c", 0, "tenant:2"))
+	assert.Nil(t, c.InvalidateTagCtx(ctx, "tenant:1"))
+	res, err := c.GetManyCtx(ctx, []string{prefix + "a", prefix + "b", prefix + "c"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{prefix + "a", prefix + "b"}, res.Missing)
+	assert.Equal(t, "c", res.Found[prefix+"c"])
+	// invalidating an unknown or already invalidated tag is a no-op
+	assert.Nil(t, c.InvalidateTagCtx(ctx, "tenant:1"))
+	assert.Nil(t, c.InvalidateTagCtx(ctx, "tenant:2"))
+	_, err = c.GetCtx(ctx, prefix+"c")
+	assert.NotNil(t, err)
+}
+
+// tagCount returns the tags and keys tracked by the memory tag index
+func tagCount(c Cache) (int, int) {
+	idx := c.(*cacheImpl).tags
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	return len(idx.tags), len(idx.keys)
+}
+
+func TestTagIndexPrunedOnDelete(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	assert.Nil(t, c.SetWithTagsCtx(ctx, "a", "a", time.Minute, "tenant:1", "order:1"))
+	assert.Nil(t, c.SetWithTagsCtx(ctx, "b", "b", time.Minute, "tenant:1"))
+	assert.Nil(t, c.SetWithTagsCtx(ctx, "c", "c", time.Minute, "tenant:2"))
+	assert.Nil(t, c.Delete("a"))
+	tags, keys := tagCount(c)
+	assert.Equal(t, 2, tags)
+	assert.Equal(t, 2, keys)
+	assert.Nil(t, c.DeleteManyCtx(ctx, []string{"b", "c"}))
+	tags, keys = tagCount(c)
+	assert.Equal(t, 0, tags)
+	assert.Equal(t, 0, keys)
+}
+
+func TestTagIndexPrunedOnEviction(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, 5*time.Millisecond)
+	assert.Nil(t, c.SetWithTagsCtx(ctx, "a", "a", time.Millisecond, "tenant:1"))
+	assert.Eventually(t, func() bool {
+		tags, keys := tagCount(c)
+		return tags == 0 && keys == 0
+	}, time.Second, 5*time.Millisecond)
+
+	bounded, err := InitBoundedMemoryCache(&BoundedMemoryOptions{MaxEntries: 1})
+	assert.Nil(t, err)
+	assert.Nil(t, bounded.SetWithTagsCtx(ctx, "a", "a", time.Minute, "tenant:1"))
+	assert.Nil(t, bounded.SetWithTagsCtx(ctx, "b", "b", time.Minute, "tenant:2"))
+	assert.Eventually(t, func() bool {
+		tags, keys := tagCount(bounded)
+		return tags == 1 && keys == 1
+	}, time.Second, 5*time.Millisecond)
+}
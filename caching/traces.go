@@ -0,0 +1,41 @@
+package caching
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// observe logs a single cache operation and records it through record
+// params:
+//   - ctx: context
+//   - command: dependency command name (e.g. "MGET")
+//   - now: start of the operation
+//   - end: end of the operation
+//   - err: error returned by the operation, if any
+//   - fields: extra properties attached to the trace
+func (c *cacheImpl) observe(
+	ctx context.Context,
+	command string,
+	now time.Time,
+	end time.Time,
+	err error,
+	fields map[string]string,
+) {
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields["cacheType"] = c.typ
+	c.record(ctx, command, now, end, err, fields)
+	logFields := make([]zap.Field, 0, len(fields)+2)
+	for k, v := range fields {
+		logFields = append(logFields, zap.String(k, v))
+	}
+	logFields = append(logFields, zap.String("elasped", end.Sub(now).String()))
+	if err != nil {
+		c.lgr.Error("[Cache] Error executing "+command, append(logFields, zap.Error(err))...)
+		return
+	}
+	c.lgr.Info("[Cache] "+command, logFields...)
+}
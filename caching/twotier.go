@@ -0,0 +1,199 @@
+package caching
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// TwoTierOptions configures the in-memory (L1) tier of a two tier cache
+// params:
+//   - L1Expiration: how long an entry is kept in memory, defaults to a minute
+//   - L1CleanupInterval: how often expired L1 entries are purged, defaults to twice the expiration
+//   - L1MaxItems: maximum number of entries kept in memory, 0 means unbounded
+//   - L1Policy: policy evicting entries from a full L1, defaults to LRU_EVICTION_POLICY
+type TwoTierOptions struct {
+	L1Expiration      time.Duration
+	L1CleanupInterval time.Duration
+	L1MaxItems        int
+	L1Policy          EvictionPolicy
+}
+
+// InitTwoTierCache initializes a near cache, an in-memory L1 in front of a redis L2
+// reads are served from L1 first and fill it on a miss, writes and deletes go to both tiers,
+// L1 holds values the way redis returns them and never outlives the redis entry
+// params:
+//   - url: redis url
+//   - opts: L1 options, defaults are used when nil
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitTwoTierCache(
+	url string,
+	opts *TwoTierOptions,
+) (Cache, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return newTwoTierCache(redis.NewClient(opt), opts, true), nil
+}
+
+// InitTwoTierCacheWithClient initializes a near cache around an existing redis client
+// params:
+//   - client: a *redis.Client, *redis.ClusterClient or sentinel backed client
+//   - opts: L1 options, defaults are used when nil
+//
+// returns:
+//   - Cache: cache instance
+//   - error: error if any
+func InitTwoTierCacheWithClient(
+	client redis.UniversalClient,
+	opts *TwoTierOptions,
+) (Cache, error) {
+	if client == nil {
+		return nil, Err_INVALID_REDIS_OPTIONS
+	}
+	return newTwoTierCache(client, opts, false), nil
+}
+
+// newTwoTierCache builds a two tier cache and starts the health monitor of its L2
+// closeClient tells whether Close closes the client as well
+func newTwoTierCache(
+	client redis.UniversalClient,
+	opts *TwoTierOptions,
+	closeClient bool,
+) *cacheImpl {
+	if opts == nil {
+		opts = &TwoTierOptions{}
+	}
+	if opts.L1Expiration <= 0 {
+		opts.L1Expiration = time.Minute
+	}
+	if opts.L1CleanupInterval <= 0 {
+		opts.L1CleanupInterval = 2 * opts.L1Expiration
+	}
+	mem := newGoCacheStore(opts.L1Expiration, opts.L1CleanupInterval)
+	if opts.L1MaxItems > 0 {
+		policy := opts.L1Policy
+		if policy == "" {
+			policy = LRU_EVICTION_POLICY
+		}
+		mem = newBoundedStore(&BoundedMemoryOptions{
+			MaxEntries:      opts.L1MaxItems,
+			Policy:          policy,
+			Expiration:      opts.L1Expiration,
+			CleanupInterval: opts.L1CleanupInterval,
+		})
+	}
+	metrics := metricsFor("", TWO_TIER_CACHE_TYPE)
+	c := &cacheImpl{
+		typ:       TWO_TIER_CACHE_TYPE,
+		redis:     client,
+		mem:       mem,
+		lgr:       zap.NewNop(),
+		l1TTL:     opts.L1Expiration,
+		flights:   newFlightGroup(),
+		health:    newHealthMonitor(client, TWO_TIER_CACHE_TYPE, closeClient),
+		metrics:   metrics,
+		evictions: newEvictionTracker(metrics),
+	}
+	c.watchEvictions()
+	return c
+}
+
+// ===============================================================================	Two	Tier	Cache	=========================================================================
+func (c *cacheImpl) fetchFromTwoTierCache(
+	ctx context.Context,
+	key string,
+) (interface{}, error) {
+	if v, ok := c.mem.Get(key); ok {
+		return v, nil
+	}
+	if err := c.available(); err != nil {
+		return nil, err
+	}
+	pipe := c.redis.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	// per command errors are read below
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	v, err := get.Result()
+	if err == redis.Nil {
+		return nil, Err_KEY_NOT_FOUND
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.fillL1(key, v, pttl.Val())
+	return v, nil
+}
+
+func (c *cacheImpl) setTwoTierCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+) error {
+	if err := c.setRedisCache(ctx, key, value); err != nil {
+		c.deleteMem(key)
+		return err
+	}
+	c.setL1(key, value, c.l1TTL)
+	return nil
+}
+
+func (c *cacheImpl) setWithExpiryTwoTierCache(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiry time.Duration,
+) error {
+	if err := c.setWithExpiryRedisCache(ctx, key, value, expiry); err != nil {
+		c.deleteMem(key)
+		return err
+	}
+	ttl := c.l1TTL
+	if expiry > 0 && expiry < ttl {
+		ttl = expiry
+	}
+	c.setL1(key, value, ttl)
+	return nil
+}
+
+func (c *cacheImpl) deleteFromTwoTierCache(
+	ctx context.Context,
+	key string,
+) error {
+	c.deleteMem(key)
+	return c.deleteFromRedisCache(ctx, key)
+}
+
+// setL1 stores the value in the memory tier the way redis returns it, so reads
+// return the same type whether they hit L1 or redis
+func (c *cacheImpl) setL1(key string, value interface{}, ttl time.Duration) {
+	byts, err := encodeDiskValue(value)
+	if err != nil {
+		c.deleteMem(key)
+		return
+	}
+	c.mem.Set(key, string(byts), ttl)
+}
+
+// fillL1 stores a value read from redis in the memory tier for at most the
+// remaining lifetime of the redis entry, pttl is the reply of PTTL
+func (c *cacheImpl) fillL1(key string, value string, pttl time.Duration) {
+	ttl := c.l1TTL
+	switch {
+	case pttl == -2 || pttl == 0:
+		// the entry expired since it was read
+		return
+	case pttl > 0 && pttl < ttl:
+		ttl = pttl
+	}
+	c.mem.Set(key, value, ttl)
+}
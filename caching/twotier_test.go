@@ -0,0 +1,91 @@
+package caching
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwoTierReadThrough(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := InitTwoTierCache(redisUri, &TwoTierOptions{L1Expiration: time.Minute})
+	assert.Nil(t, err)
+	impl := c.(*cacheImpl)
+	err = c.SetWithExpiration("two_tier_test", "hello", time.Minute)
+	assert.Nil(t, err)
+	// drop the L1 copy so the next read goes to redis and refills it
+	impl.mem.Delete("two_tier_test")
+	val, err := c.Get("two_tier_test")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", val)
+	_, found := impl.mem.Get("two_tier_test")
+	assert.True(t, found)
+	err = c.Delete("two_tier_test")
+	assert.Nil(t, err)
+	_, err = c.Get("two_tier_test")
+	assert.Equal(t, Err_KEY_NOT_FOUND, err)
+}
+
+func TestTwoTierL1MaxItems(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := InitTwoTierCache(redisUri, &TwoTierOptions{L1MaxItems: 1})
+	assert.Nil(t, err)
+	impl := c.(*cacheImpl)
+	assert.Nil(t, c.SetWithExpiration("two_tier_a", "a", time.Minute))
+	assert.Nil(t, c.SetWithExpiration("two_tier_b", "b", time.Minute))
+	// a full L1 evicts to make room for the new key
+	assert.Equal(t, 1, impl.mem.Len())
+	_, found := impl.mem.Get("two_tier_b")
+	assert.True(t, found)
+	val, err := c.Get("two_tier_a")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+	_, found = impl.mem.Get("two_tier_a")
+	assert.True(t, found)
+	assert.Equal(t, 1, impl.mem.Len())
+}
+
+func TestTwoTierL1FollowsRedisTTL(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := InitTwoTierCache(redisUri, &TwoTierOptions{L1Expiration: time.Hour})
+	assert.Nil(t, err)
+	defer c.Close()
+	impl := c.(*cacheImpl)
+	client, _ := RedisClient(c)
+	ctx := context.Background()
+	assert.Nil(t, client.Set(ctx, "two_tier_ttl", "v", 2*time.Second).Err())
+	assert.Nil(t, client.Set(ctx, "two_tier_ttl_many", "v", 2*time.Second).Err())
+
+	_, err = c.GetCtx(ctx, "two_tier_ttl")
+	assert.Nil(t, err)
+	_, err = c.GetManyCtx(ctx, []string{"two_tier_ttl_many"})
+	assert.Nil(t, err)
+	// the L1 copies expire with the redis entries, not after L1Expiration
+	items := impl.mem.Items()
+	for _, key := range []string{"two_tier_ttl", "two_tier_ttl_many"} {
+		item, ok := items[key]
+		assert.True(t, ok, key)
+		assert.LessOrEqual(t, item.Expiration, time.Now().Add(2*time.Second).UnixNano(), key)
+	}
+	assert.Nil(t, client.Del(ctx, "two_tier_ttl", "two_tier_ttl_many").Err())
+}
+
+func TestTwoTierSameTypeFromBothTiers(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := InitTwoTierCache(redisUri, nil)
+	assert.Nil(t, err)
+	defer c.Close()
+	impl := c.(*cacheImpl)
+	ctx := context.Background()
+	assert.Nil(t, c.SetCtx(ctx, "two_tier_type", 42))
+	fromL1, err := c.GetCtx(ctx, "two_tier_type")
+	assert.Nil(t, err)
+	impl.mem.Delete("two_tier_type")
+	fromRedis, err := c.GetCtx(ctx, "two_tier_type")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", fromL1)
+	assert.Equal(t, fromRedis, fromL1)
+	assert.Nil(t, c.DeleteCtx(ctx, "two_tier_type"))
+}
@@ -0,0 +1,107 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const default_warm_concurrency = 8
+
+// WarmFn computes the value of a key while warming the cache
+type WarmFn func(ctx context.Context, key string) (interface{}, error)
+
+// WarmOptions configures Warm
+// params:
+//   - Concurrency: how many keys are loaded at the same time, defaults to 8
+//   - TTL: expiration of the warmed entries, 0 keeps the backend default
+//   - Overwrite: reload keys that are already cached, by default they are skipped
+type WarmOptions struct {
+	Concurrency int
+	TTL         time.Duration
+	Overwrite   bool
+}
+
+// Warm prefills the cache by calling loader for each key with bounded concurrency
+// a failing key does not stop the others, their errors are joined
+// params:
+//   - ctx: context, cancelling it stops dispatching the remaining keys
+//   - keys:[]string => keys to warm
+//   - opts: warm options, defaults are used when nil
+//   - loader: function computing the value of a key
+//
+// returns:
+//   - int: number of warmed keys
+//   - error: errors of the keys that could not be warmed
+func (c *cacheImpl) Warm(
+	ctx context.Context,
+	keys []string,
+	opts *WarmOptions,
+	loader WarmFn,
+) (int, error) {
+	if opts == nil {
+		opts = &WarmOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = default_warm_concurrency
+	}
+	now := time.Now()
+	if !opts.Overwrite && len(keys) > 0 {
+		res, err := c.GetManyCtx(ctx, keys)
+		if err != nil {
+			return 0, err
+		}
+		keys = res.Missing
+	}
+	if concurrency > len(keys) {
+		concurrency = len(keys)
+	}
+
+	jobs := make(chan string)
+	mtx := sync.Mutex{}
+	warmed := 0
+	errs := []error{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				value, err := loader(ctx, key)
+				if err == nil {
+					err = c.SetWithExpirationCtx(ctx, key, value, opts.TTL)
+				}
+				mtx.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					warmed++
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+dispatch:
+	for _, key := range keys {
+		select {
+		case jobs <- key:
+		case <-ctx.Done():
+			mtx.Lock()
+			errs = append(errs, ctx.Err())
+			mtx.Unlock()
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	c.observe(ctx, "WARM", now, time.Now(), err, map[string]string{
+		"keys":   strconv.Itoa(len(keys)),
+		"warmed": strconv.Itoa(warmed),
+	})
+	return warmed, err
+}
@@ -0,0 +1,68 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarm(t *testing.T) {
+	ctx := context.Background()
+	c := InitMemoryCache(time.Minute, time.Minute).WithName("warm")
+	assert.Nil(t, c.SetCtx(ctx, "cached", "old"))
+	var running, peak, calls int32
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if key == "broken" {
+			return nil, fmt.Errorf("boom")
+		}
+		return "value " + key, nil
+	}
+	keys := []string{"cached", "broken"}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+	}
+	n, err := c.Warm(ctx, keys, &WarmOptions{Concurrency: 3}, loader)
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, 10, n)
+	// cached keys are skipped unless overwritten
+	assert.Equal(t, int32(11), calls)
+	assert.LessOrEqual(t, peak, int32(3))
+	v, err := c.GetCtx(ctx, "key7")
+	assert.Nil(t, err)
+	assert.Equal(t, "value key7", v)
+	v, err = c.GetCtx(ctx, "cached")
+	assert.Nil(t, err)
+	assert.Equal(t, "old", v)
+
+	n, err = c.Warm(ctx, []string{"cached"}, &WarmOptions{Overwrite: true}, loader)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	v, err = c.GetCtx(ctx, "cached")
+	assert.Nil(t, err)
+	assert.Equal(t, "value cached", v)
+}
+
+func TestWarmCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := InitMemoryCache(time.Minute, time.Minute)
+	n, err := c.Warm(ctx, []string{"a", "b"}, nil, func(ctx context.Context, key string) (interface{}, error) {
+		return key, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.LessOrEqual(t, n, 2)
+}
@@ -0,0 +1,322 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var Err_INVALID_BREAKER_OPTIONS = fmt.Errorf("invalid circuit breaker options")
+
+// ErrCircuitOpen is returned instead of calling a remote whose circuit is open
+type ErrCircuitOpen struct {
+	// Name of the breaker, e.g. the host or the client name
+	Name string
+	// RetryAfter is how long until the breaker lets a probe through
+	RetryAfter time.Duration
+}
+
+func (e *ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit %q is open, retry after %s", e.Name, e.RetryAfter)
+}
+
+// State of a breaker
+type State int8
+
+const (
+	// STATE_CLOSED lets every call through and counts the failures
+	STATE_CLOSED State = iota
+	// STATE_OPEN rejects every call until OpenTimeout elapses
+	STATE_OPEN
+	// STATE_HALF_OPEN lets HalfOpenRequests probes through, they close the circuit
+	// when all of them succeed and open it again on the first failure, probes that
+	// did not report within OpenTimeout are dropped and new ones are let through
+	STATE_HALF_OPEN
+)
+
+func (s State) String() string {
+	switch s {
+	case STATE_CLOSED:
+		return "closed"
+	case STATE_OPEN:
+		return "open"
+	case STATE_HALF_OPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Outcome of a call allowed by a breaker
+type Outcome int8
+
+const (
+	// OUTCOME_SUCCESS counts the call as a success
+	OUTCOME_SUCCESS Outcome = iota
+	// OUTCOME_FAILURE counts the call as a failure
+	OUTCOME_FAILURE
+	// OUTCOME_IGNORED records nothing and frees the slot of the call, for calls
+	// that say nothing about the remote such as the ones cancelled by the caller
+	OUTCOME_IGNORED
+)
+
+// HTTPOutcome classifies the outcome of an http call, calls cancelled by the caller
+// say nothing about the remote and are ignored, network errors and 5xx responses
+// are failures
+// params:
+//   - req: request sent
+//   - res: response, nil when err is set
+//   - err: error of the round trip
+//
+// returns:
+//   - Outcome: outcome to report to the breaker
+func HTTPOutcome(req *http.Request, res *http.Response, err error) Outcome {
+	switch {
+	case req.Context().Err() != nil:
+		return OUTCOME_IGNORED
+	case err != nil || res == nil || res.StatusCode >= 500:
+		return OUTCOME_FAILURE
+	}
+	return OUTCOME_SUCCESS
+}
+
+// Options configures a breaker
+// params:
+//   - FailureThreshold: consecutive failures opening the circuit, defaults to 5
+//   - FailureRatio: ratio of failed calls opening the circuit, between 0 and 1, disabled when 0
+//   - MinRequests: calls needed before FailureRatio applies, defaults to 10
+//   - Window: the closed state counts reset every Window, never when 0
+//   - OpenTimeout: how long the circuit stays open before probing, defaults to 30 seconds
+//   - HalfOpenRequests: probes allowed while half open, defaults to 1
+//   - OnStateChange: called on every state change while the breaker is locked, it must
+//     not block nor use the breaker
+type Options struct {
+	FailureThreshold int
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	OnStateChange    func(name string, from State, to State)
+}
+
+// Counts of the calls in the current state
+type Counts struct {
+	Requests             int
+	Successes            int
+	Failures             int
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
+}
+
+// Breaker stops calling a failing remote until it recovers
+type Breaker interface {
+	// Name of the breaker
+	Name() string
+	// State of the breaker
+	State() State
+	// Counts of the calls in the current state
+	Counts() Counts
+	// Allow reserves a call, done must be called with its outcome, later calls are ignored
+	// returns *ErrCircuitOpen when the call is rejected
+	Allow() (done func(outcome Outcome), err error)
+	// Execute runs fn when the circuit allows it, errors of fn count as failures
+	Execute(fn func() error) error
+	// Reset closes the circuit and clears its counts
+	Reset()
+}
+
+type breakerImpl struct {
+	name       string
+	opts       Options
+	now        func() time.Time
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	counts     Counts
+	expiry     time.Time
+}
+
+// NewBreaker returns a closed breaker
+// params:
+//   - name: name of the breaker, passed to OnStateChange and ErrCircuitOpen
+//   - opts: breaker options, defaults are used when nil
+//
+// returns:
+//   - Breaker: breaker
+//   - error: Err_INVALID_BREAKER_OPTIONS if the options are out of range
+func NewBreaker(name string, opts *Options) (Breaker, error) {
+	cfg, err := withDefaults(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newBreaker(name, cfg, time.Now), nil
+}
+
+func withDefaults(opts *Options) (Options, error) {
+	cfg := Options{}
+	if opts != nil {
+		cfg = *opts
+	}
+	if cfg.FailureThreshold < 0 || cfg.FailureRatio < 0 || cfg.FailureRatio > 1 ||
+		cfg.MinRequests < 0 || cfg.Window < 0 || cfg.OpenTimeout < 0 || cfg.HalfOpenRequests < 0 {
+		return cfg, Err_INVALID_BREAKER_OPTIONS
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.OpenTimeout == 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests == 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return cfg, nil
+}
+
+func newBreaker(name string, cfg Options, now func() time.Time) *breakerImpl {
+	b := &breakerImpl{name: name, opts: cfg, now: now}
+	b.setState(STATE_CLOSED, now())
+	return b
+}
+
+func (b *breakerImpl) Name() string {
+	return b.name
+}
+
+func (b *breakerImpl) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, _ := b.current(b.now())
+	return state
+}
+
+func (b *breakerImpl) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current(b.now())
+	return b.counts
+}
+
+func (b *breakerImpl) Allow() (func(outcome Outcome), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	state, generation := b.current(now)
+	switch {
+	case state == STATE_OPEN:
+		return nil, &ErrCircuitOpen{Name: b.name, RetryAfter: b.expiry.Sub(now)}
+	case state == STATE_HALF_OPEN && b.counts.Requests >= b.opts.HalfOpenRequests:
+		return nil, &ErrCircuitOpen{Name: b.name, RetryAfter: b.expiry.Sub(now)}
+	}
+	b.counts.Requests++
+	once := sync.Once{}
+	return func(outcome Outcome) {
+		once.Do(func() {
+			b.done(generation, outcome)
+		})
+	}, nil
+}
+
+func (b *breakerImpl) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			done(OUTCOME_FAILURE)
+			panic(p)
+		}
+	}()
+	if err = fn(); err != nil {
+		done(OUTCOME_FAILURE)
+	} else {
+		done(OUTCOME_SUCCESS)
+	}
+	return err
+}
+
+func (b *breakerImpl) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setState(STATE_CLOSED, b.now())
+}
+
+// done records the outcome of a call, calls started in a previous state are ignored
+func (b *breakerImpl) done(generation uint64, outcome Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	state, current := b.current(now)
+	if generation != current {
+		return
+	}
+	switch outcome {
+	case OUTCOME_IGNORED:
+		b.counts.Requests--
+		return
+	case OUTCOME_SUCCESS:
+		b.counts.Successes++
+		b.counts.ConsecutiveSuccesses++
+		b.counts.ConsecutiveFailures = 0
+		if state == STATE_HALF_OPEN && b.counts.ConsecutiveSuccesses >= b.opts.HalfOpenRequests {
+			b.setState(STATE_CLOSED, now)
+		}
+		return
+	}
+	b.counts.Failures++
+	b.counts.ConsecutiveFailures++
+	b.counts.ConsecutiveSuccesses = 0
+	if state == STATE_HALF_OPEN || b.tripped() {
+		b.setState(STATE_OPEN, now)
+	}
+}
+
+// tripped reports whether the closed state counts should open the circuit
+func (b *breakerImpl) tripped() bool {
+	if b.counts.ConsecutiveFailures >= b.opts.FailureThreshold {
+		return true
+	}
+	return b.opts.FailureRatio > 0 && b.counts.Requests >= b.opts.MinRequests &&
+		float64(b.counts.Failures)/float64(b.counts.Requests) >= b.opts.FailureRatio
+}
+
+// current moves to the state due at now, the lock must be held
+func (b *breakerImpl) current(now time.Time) (State, uint64) {
+	switch b.state {
+	case STATE_CLOSED:
+		if !b.expiry.IsZero() && !now.Before(b.expiry) {
+			b.setState(STATE_CLOSED, now)
+		}
+	case STATE_OPEN, STATE_HALF_OPEN:
+		// a half open state whose probes never reported starts probing again
+		if !now.Before(b.expiry) {
+			b.setState(STATE_HALF_OPEN, now)
+		}
+	}
+	return b.state, b.generation
+}
+
+// setState starts a new generation in the given state, the lock must be held
+func (b *breakerImpl) setState(state State, now time.Time) {
+	prev := b.state
+	b.state = state
+	b.generation++
+	b.counts = Counts{}
+	switch state {
+	case STATE_CLOSED:
+		b.expiry = time.Time{}
+		if b.opts.Window > 0 {
+			b.expiry = now.Add(b.opts.Window)
+		}
+	case STATE_OPEN, STATE_HALF_OPEN:
+		b.expiry = now.Add(b.opts.OpenTimeout)
+	}
+	if prev != state && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(b.name, prev, state)
+	}
+}
@@ -0,0 +1,214 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func testBreaker(t *testing.T, opts *Options) (*breakerImpl, *fakeClock) {
+	cfg, err := withDefaults(opts)
+	assert.Nil(t, err)
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return newBreaker("partner", cfg, clock.now), clock
+}
+
+func fail() error { return errors.New("boom") }
+
+func succeed() error { return nil }
+
+func TestInvalidOptions(t *testing.T) {
+	_, err := NewBreaker("partner", &Options{FailureRatio: 2})
+	assert.Equal(t, Err_INVALID_BREAKER_OPTIONS, err)
+	_, err = NewBreaker("partner", &Options{OpenTimeout: -time.Second})
+	assert.Equal(t, Err_INVALID_BREAKER_OPTIONS, err)
+	b, err := NewBreaker("partner", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, STATE_CLOSED, b.State())
+	assert.Equal(t, "partner", b.Name())
+}
+
+func TestBreakerLifecycle(t *testing.T) {
+	changes := []string{}
+	b, clock := testBreaker(t, &Options{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 2,
+		OnStateChange: func(name string, from, to State) {
+			changes = append(changes, name+":"+from.String()+"->"+to.String())
+		},
+	})
+	assert.NotNil(t, b.Execute(fail))
+	assert.NotNil(t, b.Execute(fail))
+	assert.Nil(t, b.Execute(succeed))
+	// a success breaks the streak
+	assert.NotNil(t, b.Execute(fail))
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, STATE_CLOSED, b.State())
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, STATE_OPEN, b.State())
+
+	called := false
+	err := b.Execute(func() error { called = true; return nil })
+	assert.False(t, called)
+	var open *ErrCircuitOpen
+	assert.True(t, errors.As(err, &open))
+	assert.Equal(t, "partner", open.Name)
+	assert.Equal(t, time.Minute, open.RetryAfter)
+
+	// the first failed probe opens the circuit again
+	clock.advance(time.Minute)
+	assert.Equal(t, STATE_HALF_OPEN, b.State())
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, STATE_OPEN, b.State())
+
+	// only HalfOpenRequests probes go through at once
+	clock.advance(time.Minute)
+	done1, err := b.Allow()
+	assert.Nil(t, err)
+	done2, err := b.Allow()
+	assert.Nil(t, err)
+	_, err = b.Allow()
+	assert.True(t, errors.As(err, &open))
+	done1(OUTCOME_SUCCESS)
+	assert.Equal(t, STATE_HALF_OPEN, b.State())
+	done2(OUTCOME_SUCCESS)
+	assert.Equal(t, STATE_CLOSED, b.State())
+
+	assert.Equal(t, []string{
+		"partner:closed->open",
+		"partner:open->half-open",
+		"partner:half-open->open",
+		"partner:open->half-open",
+		"partner:half-open->closed",
+	}, changes)
+}
+
+func TestFailureRatioAndWindow(t *testing.T) {
+	b, clock := testBreaker(t, &Options{
+		FailureThreshold: 100,
+		FailureRatio:     0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+	})
+	b.Execute(fail)
+	b.Execute(succeed)
+	b.Execute(fail)
+	assert.Equal(t, Counts{Requests: 3, Successes: 1, Failures: 2, ConsecutiveFailures: 1}, b.Counts())
+	// the counts of the previous window are dropped
+	clock.advance(time.Minute)
+	assert.Equal(t, Counts{}, b.Counts())
+	b.Execute(succeed)
+	b.Execute(succeed)
+	b.Execute(fail)
+	assert.Equal(t, STATE_CLOSED, b.State())
+	b.Execute(fail)
+	assert.Equal(t, STATE_OPEN, b.State())
+}
+
+func TestStaleOutcomesAreIgnored(t *testing.T) {
+	b, _ := testBreaker(t, &Options{FailureThreshold: 1})
+	done, err := b.Allow()
+	assert.Nil(t, err)
+	b.Execute(fail)
+	assert.Equal(t, STATE_OPEN, b.State())
+	// a call started while closed can't close the open circuit
+	done(OUTCOME_SUCCESS)
+	assert.Equal(t, STATE_OPEN, b.State())
+	b.Reset()
+	assert.Equal(t, STATE_CLOSED, b.State())
+}
+
+func TestIgnoredOutcome(t *testing.T) {
+	b, clock := testBreaker(t, &Options{FailureThreshold: 1, OpenTimeout: time.Minute})
+	done, err := b.Allow()
+	assert.Nil(t, err)
+	done(OUTCOME_IGNORED)
+	assert.Equal(t, Counts{}, b.Counts())
+	assert.Equal(t, STATE_CLOSED, b.State())
+
+	b.Execute(fail)
+	clock.advance(time.Minute)
+	assert.Equal(t, STATE_HALF_OPEN, b.State())
+	// an ignored probe neither closes nor opens the circuit and frees its slot
+	done, err = b.Allow()
+	assert.Nil(t, err)
+	_, err = b.Allow()
+	assert.NotNil(t, err)
+	done(OUTCOME_IGNORED)
+	assert.Equal(t, STATE_HALF_OPEN, b.State())
+	assert.Nil(t, b.Execute(succeed))
+	assert.Equal(t, STATE_CLOSED, b.State())
+}
+
+func TestDoneCountsOnce(t *testing.T) {
+	b, _ := testBreaker(t, &Options{FailureThreshold: 2})
+	done, err := b.Allow()
+	assert.Nil(t, err)
+	done(OUTCOME_FAILURE)
+	done(OUTCOME_FAILURE)
+	assert.Equal(t, Counts{Requests: 1, Failures: 1, ConsecutiveFailures: 1}, b.Counts())
+	assert.Equal(t, STATE_CLOSED, b.State())
+}
+
+func TestStuckProbeExpires(t *testing.T) {
+	b, clock := testBreaker(t, &Options{FailureThreshold: 1, OpenTimeout: time.Minute})
+	b.Execute(fail)
+	clock.advance(time.Minute)
+	stuck, err := b.Allow()
+	assert.Nil(t, err)
+	var open *ErrCircuitOpen
+	_, err = b.Allow()
+	assert.True(t, errors.As(err, &open))
+	assert.Equal(t, time.Minute, open.RetryAfter)
+
+	// the probe never reported, a new one goes through after OpenTimeout
+	clock.advance(time.Minute)
+	assert.Equal(t, STATE_HALF_OPEN, b.State())
+	assert.Nil(t, b.Execute(succeed))
+	assert.Equal(t, STATE_CLOSED, b.State())
+	// the late outcome belongs to an old state and is ignored
+	stuck(OUTCOME_FAILURE)
+	assert.Equal(t, STATE_CLOSED, b.State())
+}
+
+func TestHTTPOutcome(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, OUTCOME_SUCCESS, HTTPOutcome(req, &http.Response{StatusCode: 404}, nil))
+	assert.Equal(t, OUTCOME_FAILURE, HTTPOutcome(req, &http.Response{StatusCode: 503}, nil))
+	assert.Equal(t, OUTCOME_FAILURE, HTTPOutcome(req, nil, errors.New("refused")))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, OUTCOME_IGNORED, HTTPOutcome(req.WithContext(ctx), nil, ctx.Err()))
+}
+
+func TestExecutePanics(t *testing.T) {
+	b, _ := testBreaker(t, &Options{FailureThreshold: 1})
+	assert.Panics(t, func() {
+		b.Execute(func() error { panic("boom") })
+	})
+	assert.Equal(t, STATE_OPEN, b.State())
+}
@@ -0,0 +1,70 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// Registry hands out one breaker per name, e.g. per remote host
+type Registry interface {
+	// Get returns the breaker of the name, creating it on first use
+	Get(name string) Breaker
+	// States returns the state of every breaker created so far
+	States() map[string]State
+}
+
+type registryImpl struct {
+	opts     Options
+	now      func() time.Time
+	mu       sync.RWMutex
+	breakers map[string]*breakerImpl
+}
+
+// NewRegistry returns a registry whose breakers share the options
+// params:
+//   - opts: options of every breaker, defaults are used when nil
+//
+// returns:
+//   - Registry: registry
+//   - error: Err_INVALID_BREAKER_OPTIONS if the options are out of range
+func NewRegistry(opts *Options) (Registry, error) {
+	cfg, err := withDefaults(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &registryImpl{
+		opts:     cfg,
+		now:      time.Now,
+		breakers: map[string]*breakerImpl{},
+	}, nil
+}
+
+func (r *registryImpl) Get(name string) Breaker {
+	r.mu.RLock()
+	b, ok := r.breakers[name]
+	r.mu.RUnlock()
+	if ok {
+		return b
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok = r.breakers[name]; !ok {
+		b = newBreaker(name, r.opts, r.now)
+		r.breakers[name] = b
+	}
+	return b
+}
+
+func (r *registryImpl) States() map[string]State {
+	r.mu.RLock()
+	breakers := make([]*breakerImpl, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	r.mu.RUnlock()
+	states := make(map[string]State, len(breakers))
+	for _, b := range breakers {
+		states[b.name] = b.State()
+	}
+	return states
+}
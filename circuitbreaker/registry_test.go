@@ -0,0 +1,37 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	_, err := NewRegistry(&Options{HalfOpenRequests: -1})
+	assert.Equal(t, Err_INVALID_BREAKER_OPTIONS, err)
+
+	r, err := NewRegistry(&Options{FailureThreshold: 1})
+	assert.Nil(t, err)
+	wg := sync.WaitGroup{}
+	breakers := make([]Breaker, 10)
+	for i := range breakers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			breakers[i] = r.Get("a.example.com")
+		}(i)
+	}
+	wg.Wait()
+	for _, b := range breakers {
+		assert.Same(t, breakers[0], b)
+	}
+
+	r.Get("a.example.com").Execute(func() error { return errors.New("boom") })
+	r.Get("b.example.com").Execute(func() error { return nil })
+	assert.Equal(t, map[string]State{
+		"a.example.com": STATE_OPEN,
+		"b.example.com": STATE_CLOSED,
+	}, r.States())
+}
@@ -0,0 +1,35 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/karim-w/stdlib/circuitbreaker"
+)
+
+// CircuitBreaker rejects the attempts to a remote whose circuit is open with a
+// *circuitbreaker.ErrCircuitOpen, attempts failing with a network error or a 5xx
+// status count as failures, attempts cancelled by the caller are not counted,
+// the retry conditions never retry a rejected attempt
+// params:
+//   - registry: breakers of the remotes
+//   - name: breaker of every request, the host of the request when empty
+//
+// returns:
+//   - Middleware: middleware
+func CircuitBreaker(registry circuitbreaker.Registry, name string) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			key := name
+			if key == "" {
+				key = req.URL.Host
+			}
+			done, err := registry.Get(key).Allow()
+			if err != nil {
+				return nil, err
+			}
+			res, err := next(req)
+			done(circuitbreaker.HTTPOutcome(req, res, err))
+			return res, err
+		}
+	}
+}
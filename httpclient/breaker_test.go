@@ -0,0 +1,105 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/karim-w/stdlib/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	registry, err := circuitbreaker.NewRegistry(&circuitbreaker.Options{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+	})
+	assert.Nil(t, err)
+	c := NewClient(&ClientOptions{BaseURL: srv.URL, Breaker: registry, Name: "partner"})
+	defer c.Close()
+
+	// the retries stop as soon as the circuit opens
+	res := c.R("/").WithRetries(CONSTANT_BACKOFF, 5, time.Millisecond).Get()
+	var open *circuitbreaker.ErrCircuitOpen
+	assert.True(t, errors.As(res.CatchError(), &open))
+	assert.Equal(t, "partner", open.Name)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, circuitbreaker.STATE_OPEN, registry.States()["partner"])
+}
+
+func TestCircuitBreakerPerHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	registry, err := circuitbreaker.NewRegistry(&circuitbreaker.Options{FailureThreshold: 1})
+	assert.Nil(t, err)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	// client errors are not failures of the remote
+	res := Req(srv.URL + "/missing").Use(CircuitBreaker(registry, "")).Get()
+	assert.Equal(t, http.StatusNotFound, res.GetStatusCode())
+	assert.Equal(t, circuitbreaker.STATE_CLOSED, registry.States()[host])
+
+	res = Req(srv.URL + "/fail").Use(CircuitBreaker(registry, "")).Get()
+	assert.Equal(t, http.StatusInternalServerError, res.GetStatusCode())
+	assert.Equal(t, circuitbreaker.STATE_OPEN, registry.States()[host])
+	res = Req(srv.URL + "/missing").Use(CircuitBreaker(registry, "")).Get()
+	assert.Equal(t, -1, res.GetStatusCode())
+}
+
+func TestCircuitBreakerCancelledProbe(t *testing.T) {
+	var fail int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	registry, err := circuitbreaker.NewRegistry(&circuitbreaker.Options{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	c := NewClient(&ClientOptions{BaseURL: srv.URL, Breaker: registry, Name: "partner"})
+	defer c.Close()
+
+	c.R("/").Get()
+	assert.Equal(t, circuitbreaker.STATE_OPEN, registry.States()["partner"])
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, circuitbreaker.STATE_HALF_OPEN, registry.States()["partner"])
+
+	// the probe is cancelled by the caller, it says nothing about the remote
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	res := c.R("/slow").WithContext(ctx).Get()
+	assert.True(t, errors.Is(res.CatchError(), context.DeadlineExceeded))
+	assert.Equal(t, circuitbreaker.STATE_HALF_OPEN, registry.States()["partner"])
+
+	// its slot is free again for the next probe
+	atomic.StoreInt32(&fail, 0)
+	res = c.R("/").Get()
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, circuitbreaker.STATE_CLOSED, registry.States()["partner"])
+}
@@ -0,0 +1,165 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/karim-w/stdlib"
+	"github.com/karim-w/stdlib/circuitbreaker"
+)
+
+// Client is a long lived http client, the requests it builds share its defaults
+// and its connection pool
+type Client interface {
+	// R builds a request for a path relative to the base url, absolute urls are used as they are
+	R(path string) HTTPRequest
+	// Use returns a copy of the client with extra middlewares, the pool is shared
+	Use(middlewares ...Middleware) Client
+	// HTTPClient returns the underlying http.Client
+	HTTPClient() *http.Client
+	// Close releases the idle connections of the pool
+	Close()
+}
+
+// ClientOptions configures a Client
+// params:
+//   - BaseURL: prefix of the paths given to R
+//   - Headers: headers added to every request
+//   - Auth: provider of the Authorization header, called for every attempt
+//   - Timeout: timeout of a single attempt, none when 0
+//   - Transport: transport of the pool, a tuned clone of http.DefaultTransport when nil
+//   - Middlewares: middlewares of every request, they run before the request ones
+//   - BeforeHooks: hooks called before every request is sent
+//   - AfterHooks: hooks called after every request
+//   - Retry: retry policy of every request, requests can override it with WithRetryPolicy
+//   - Breaker: circuit breakers guarding every request, see CircuitBreaker
+//   - Name: name of the breaker of the client, the host of each request when empty
+//   - Logger: logger of the requests, logs to stdout when nil
+type ClientOptions struct {
+	BaseURL     string
+	Headers     map[string]string
+	Auth        stdlib.AuthProvider
+	Timeout     time.Duration
+	Transport   http.RoundTripper
+	Middlewares []Middleware
+	BeforeHooks []func(req *http.Request) error
+	AfterHooks  []func(req *http.Request, res *http.Response, meta HTTPMetadata, err error)
+	Retry       *RetryConfig
+	Breaker     circuitbreaker.Registry
+	Name        string
+	Logger      Logger
+}
+
+type clientImpl struct {
+	opts        ClientOptions
+	headers     http.Header
+	client      *http.Client
+	middlewares []Middleware
+}
+
+// NewClient initializes a Client
+// params:
+//   - opts: client options, defaults are used when nil
+//
+// returns:
+//   - Client: client instance
+func NewClient(opts *ClientOptions) Client {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+	c := &clientImpl{
+		opts:    *opts,
+		headers: make(http.Header, len(opts.Headers)),
+	}
+	for k, v := range opts.Headers {
+		c.headers.Set(k, v)
+	}
+	if c.opts.Logger == nil {
+		c.opts.Logger = &defaultLogger{}
+	}
+	transport := opts.Transport
+	if transport == nil {
+		transport = defaultTransport()
+	}
+	c.client = &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+	}
+	// rejected calls should not reach the auth provider
+	if opts.Breaker != nil {
+		c.middlewares = append(c.middlewares, CircuitBreaker(opts.Breaker, opts.Name))
+	}
+	if opts.Auth != nil {
+		c.middlewares = append(c.middlewares, authMiddleware(opts.Auth))
+	}
+	c.middlewares = append(c.middlewares, opts.Middlewares...)
+	return c
+}
+
+// defaultTransport keeps more idle connections per host than http.DefaultTransport
+// so concurrent calls to the same api reuse their connections
+func defaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// authMiddleware sets the Authorization header unless the request has its own
+func authMiddleware(provider stdlib.AuthProvider) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") == "" {
+				req.Header.Set("Authorization", provider.GetAuthHeader())
+			}
+			return next(req)
+		}
+	}
+}
+
+func (c *clientImpl) R(path string) HTTPRequest {
+	r := Req(c.url(path)).(*_HttpRequest)
+	r.client = c.client
+	r.logger = c.opts.Logger
+	r.headers = c.headers.Clone()
+	r.middlewares = append(r.middlewares, c.middlewares...)
+	r.httpHooks.Before = append(r.httpHooks.Before, c.opts.BeforeHooks...)
+	r.httpHooks.After = append(r.httpHooks.After, c.opts.AfterHooks...)
+	r.retry = c.opts.Retry
+	return r
+}
+
+func (c *clientImpl) url(path string) string {
+	if c.opts.BaseURL == "" || strings.Contains(path, "://") {
+		return path
+	}
+	if path == "" {
+		return c.opts.BaseURL
+	}
+	return strings.TrimSuffix(c.opts.BaseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func (c *clientImpl) Use(middlewares ...Middleware) Client {
+	newC := *c
+	newC.middlewares = append(append([]Middleware{}, c.middlewares...), middlewares...)
+	return &newC
+}
+
+func (c *clientImpl) HTTPClient() *http.Client {
+	return c.client
+}
+
+func (c *clientImpl) Close() {
+	c.client.CloseIdleConnections()
+}
@@ -0,0 +1,108 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticAuth string
+
+func (a staticAuth) GetAuthHeader() string { return string(a) }
+
+func TestClientDefaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `","auth":"` + r.Header.Get("Authorization") +
+			`","tenant":"` + r.Header.Get("X-Tenant") + `"}`))
+	}))
+	defer srv.Close()
+	var after int32
+	c := NewClient(&ClientOptions{
+		BaseURL: srv.URL + "/api/",
+		Headers: map[string]string{"X-Tenant": "acme"},
+		Auth:    staticAuth("Bearer token"),
+		AfterHooks: []func(*http.Request, *http.Response, HTTPMetadata, error){
+			func(req *http.Request, res *http.Response, meta HTTPMetadata, err error) {
+				atomic.AddInt32(&after, 1)
+			},
+		},
+	})
+	defer c.Close()
+
+	body := map[string]string{}
+	res := c.R("/orders/42").Get()
+	assert.True(t, res.IsSuccess())
+	assert.Nil(t, res.SetResult(&body))
+	assert.Equal(t, map[string]string{
+		"path":   "/api/orders/42",
+		"auth":   "Bearer token",
+		"tenant": "acme",
+	}, body)
+
+	// request settings override the client ones without leaking into it
+	body = map[string]string{}
+	res = c.R("orders").AddBasicAuth("user", "pass").Get()
+	assert.Nil(t, res.SetResult(&body))
+	assert.Equal(t, "Basic dXNlcjpwYXNz", body["auth"])
+	body = map[string]string{}
+	res = c.R(srv.URL + "/absolute").Get()
+	assert.Nil(t, res.SetResult(&body))
+	assert.Equal(t, "/absolute", body["path"])
+	assert.Equal(t, "Bearer token", body["auth"])
+	assert.Equal(t, int32(3), atomic.LoadInt32(&after))
+}
+
+func TestClientSharesConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	c := NewClient(&ClientOptions{BaseURL: srv.URL})
+	defer c.Close()
+	res := c.R("/").Get()
+	assert.True(t, res.IsSuccess())
+	res.CleanUp()
+	res = c.R("/").Get()
+	assert.True(t, res.IsSuccess())
+	assert.True(t, res.GetTraceInfo().IsConnReused)
+}
+
+func TestClientTimeoutAndMiddlewares(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte(strings.Join(r.Header.Values("X-Order"), ",")))
+	}))
+	defer srv.Close()
+	named := func(name string) Middleware {
+		return func(next RoundTrip) RoundTrip {
+			return func(req *http.Request) (*http.Response, error) {
+				req.Header.Add("X-Order", name)
+				return next(req)
+			}
+		}
+	}
+	c := NewClient(&ClientOptions{
+		BaseURL:     srv.URL,
+		Timeout:     20 * time.Millisecond,
+		Middlewares: []Middleware{named("client")},
+	})
+	defer c.Close()
+	res := c.R("/slow").Get()
+	assert.False(t, res.IsSuccess())
+	assert.NotNil(t, res.CatchError())
+
+	res = c.Use(named("copy")).R("/").Use(named("request")).Get()
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, "client,copy,request", string(res.GetBody()))
+	// the original client is left untouched
+	res = c.R("/").Get()
+	assert.Equal(t, "client", string(res.GetBody()))
+}
@@ -0,0 +1,79 @@
+package httpclient
+
+import (
+	"net/http"
+)
+
+// RoundTrip sends a request and returns its response
+type RoundTrip func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps a RoundTrip, it can mutate the request before calling next,
+// inspect or replace the response after it, or return without calling next at all
+type Middleware func(next RoundTrip) RoundTrip
+
+// chain wraps rt with the middlewares, the first middleware is the outermost
+func chain(rt RoundTrip, middlewares ...Middleware) RoundTrip {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+	return rt
+}
+
+// BeforeHook turns a before hook into a middleware, an error aborts the request
+func BeforeHook(handler func(req *http.Request) error) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			if err := handler(req); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+}
+
+type middlewareTransport struct {
+	rt RoundTrip
+}
+
+func (t *middlewareTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.rt(req)
+}
+
+// Transport wraps a http.RoundTripper with middlewares so they apply to every
+// request of a http.Client
+// params:
+//   - base: transport sending the requests, http.DefaultTransport when nil
+//   - middlewares: middlewares, the first one is the outermost
+//
+// returns:
+//   - http.RoundTripper: transport
+func Transport(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &middlewareTransport{rt: chain(base.RoundTrip, middlewares...)}
+}
+
+// Use registers middlewares on the request, they run on every attempt in the
+// order they were added
+func (r *_HttpRequest) Use(middlewares ...Middleware) HTTPRequest {
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
+// AddBeforeHook registers a hook called with the request before it is sent,
+// returning an error aborts the request with that error
+func (r *_HttpRequest) AddBeforeHook(handler func(req *http.Request) error) HTTPRequest {
+	r.httpHooks.Before = append(r.httpHooks.Before, handler)
+	return r
+}
+
+// roundTrip builds the chain of the request, before hooks run first
+func (r *_HttpRequest) roundTrip() RoundTrip {
+	middlewares := make([]Middleware, 0, len(r.httpHooks.Before)+len(r.middlewares))
+	for _, before := range r.httpHooks.Before {
+		middlewares = append(middlewares, BeforeHook(before))
+	}
+	middlewares = append(middlewares, r.middlewares...)
+	return chain(r.client.Do, middlewares...)
+}
@@ -0,0 +1,100 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Signature", r.Header.Get("X-Signature"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.Header.Get("X-Order")))
+	}))
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	srv := echoServer()
+	defer srv.Close()
+	trace := []string{}
+	named := func(name string) Middleware {
+		return func(next RoundTrip) RoundTrip {
+			return func(req *http.Request) (*http.Response, error) {
+				trace = append(trace, "before "+name)
+				req.Header.Add("X-Order", name)
+				res, err := next(req)
+				trace = append(trace, "after "+name)
+				return res, err
+			}
+		}
+	}
+	res := Req(srv.URL).
+		AddBeforeHook(func(req *http.Request) error {
+			trace = append(trace, "hook")
+			req.Header.Set("X-Signature", "signed")
+			return nil
+		}).
+		Use(named("a"), named("b")).
+		Get()
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, []string{"hook", "before a", "before b", "after b", "after a"}, trace)
+	assert.Equal(t, "a", string(res.GetBody()))
+	// middlewares work on a copy of the request headers
+	assert.Empty(t, res.GetHeaders().Get("X-Signature"))
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	cached := func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusTeapot,
+				Body:       io.NopCloser(strings.NewReader("cached")),
+				Request:    req,
+			}, nil
+		}
+	}
+	res := Req(srv.URL).Use(cached).Get()
+	assert.False(t, called)
+	assert.Equal(t, http.StatusTeapot, res.GetStatusCode())
+	assert.Equal(t, "cached", string(res.GetBody()))
+}
+
+func TestMiddlewareMutatesResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	res := Req(srv.URL).Use(func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			res, err := next(req)
+			if err == nil && res.StatusCode == http.StatusServiceUnavailable {
+				res.StatusCode = http.StatusOK
+			}
+			return res, err
+		}
+	}).Get()
+	assert.True(t, res.IsSuccess())
+}
+
+func TestTransport(t *testing.T) {
+	srv := echoServer()
+	defer srv.Close()
+	client := &http.Client{Transport: Transport(nil, BeforeHook(func(req *http.Request) error {
+		req.Header.Set("X-Signature", "signed")
+		return nil
+	}))}
+	res, err := client.Get(srv.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "signed", res.Header.Get("X-Signature"))
+}
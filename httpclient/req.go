@@ -4,13 +4,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"sync"
 	"time"
 
-	"github.com/Soreing/retrier"
 	"github.com/karim-w/stdlib"
 )
 
@@ -21,6 +21,7 @@ type HTTPRequest interface {
 	AddQueryArray(key string, value []string) HTTPRequest
 	AddBody(body interface{}) HTTPRequest
 	AddBodyRaw(body []byte) HTTPRequest
+	AddBodyReader(body io.Reader, size int64) HTTPRequest
 	AddBasicAuth(username string, password string) HTTPRequest
 	AddBearerAuth(token string) HTTPRequest
 	SetNamedPathParams(regexp string, values []string) HTTPRequest
@@ -33,9 +34,15 @@ type HTTPRequest interface {
 		retries int,
 		amount time.Duration,
 	) HTTPRequest
+	WithRetryPolicy(config *RetryConfig) HTTPRequest
 	WithContext(ctx context.Context) HTTPRequest
 	WithLogger(logger Logger) HTTPRequest
-	// AddBeforeHook(handler func(req *http.Request) error) HTTPRequest
+	WithOutputFile(path string) HTTPRequest
+	WithUploadProgress(fn ProgressFunc) HTTPRequest
+	WithDownloadProgress(fn ProgressFunc) HTTPRequest
+	Stream() HTTPRequest
+	AddBeforeHook(handler func(req *http.Request) error) HTTPRequest
+	Use(middlewares ...Middleware) HTTPRequest
 	AddAfterHook(handler func(
 		req *http.Request,
 		resp *http.Response,
@@ -68,31 +75,36 @@ type HTTPRequest interface {
 }
 
 type _HttpRequest struct {
-	logger     Logger
-	httpHooks  *HTTPHook
-	statusCode int
-	startTime  time.Time
-	endTime    time.Time
-	lock       sync.RWMutex
-	url        string
-	headers    http.Header
-	querried   bool
-	body       []byte
-	err        error
-	DevMode    bool
-	Cookies    []*http.Cookie
-	ctx        context.Context
-	withLock   bool
-	response   *http.Response
-	resBody    []byte
-	traces     *clientTrace
-	method     string
-	client     *http.Client
-	retries    struct {
-		retryPolicy RetryPolicy
-		retryCount  int
-		initialWait time.Duration
-	}
+	logger      Logger
+	httpHooks   *HTTPHook
+	middlewares []Middleware
+	statusCode  int
+	startTime   time.Time
+	endTime     time.Time
+	lock        sync.RWMutex
+	url         string
+	headers     http.Header
+	querried    bool
+	body        []byte
+	err         error
+	DevMode     bool
+	Cookies     []*http.Cookie
+	ctx         context.Context
+	withLock    bool
+	response    *http.Response
+	resBody     []byte
+	traces      *clientTrace
+	method      string
+	client      *http.Client
+	retry       *RetryConfig
+
+	bodyReader       io.Reader
+	bodySize         int64
+	bodyOffset       int64
+	stream           bool
+	outputFile       string
+	uploadProgress   ProgressFunc
+	downloadProgress ProgressFunc
 }
 
 type RetryOptions struct {
@@ -145,11 +157,13 @@ func (r *_HttpRequest) AddBody(body interface{}) HTTPRequest {
 		return r
 	}
 	r.body = byts
+	r.bodyReader = nil
 	return r
 }
 
 func (r *_HttpRequest) AddBodyRaw(body []byte) HTTPRequest {
 	r.body = body
+	r.bodyReader = nil
 	return r
 }
 
@@ -200,15 +214,18 @@ func (r *_HttpRequest) WithCookie(cookie *http.Cookie) HTTPRequest {
 	return r
 }
 
+// WithRetries retries the request with the default conditions, POST and PATCH
+// requests are only retried when they carry an Idempotency-Key header
 func (r *_HttpRequest) WithRetries(
 	policy RetryPolicy,
 	retries int,
 	amount time.Duration,
 ) HTTPRequest {
-	r.retries.retryPolicy = policy
-	r.retries.retryCount = retries
-	r.retries.initialWait = amount
-	return r
+	return r.WithRetryPolicy(&RetryConfig{
+		Policy:     policy,
+		MaxRetries: retries,
+		Delay:      amount,
+	})
 }
 
 func (r *_HttpRequest) WithContext(ctx context.Context) HTTPRequest {
@@ -216,11 +233,6 @@ func (r *_HttpRequest) WithContext(ctx context.Context) HTTPRequest {
 	return r
 }
 
-// func (r *_HttpRequest) AddBeforeHook(handler func(req *http.Request) error) HTTPRequest {
-// 	r.httpHooks.Before = append(r.httpHooks.Before, handler)
-// 	return r
-// }
-
 func (r *_HttpRequest) AddAfterHook(handler func(
 	req *http.Request,
 	resp *http.Response,
@@ -237,38 +249,8 @@ func (r *_HttpRequest) Begin() HTTPRequest {
 	return r
 }
 
-func (r *_HttpRequest) getRetrier() *retrier.Retrier {
-	switch r.retries.retryPolicy {
-	case CONSTANT_BACKOFF:
-		return retrier.NewRetrier(
-			r.retries.retryCount,
-			retrier.ConstantDelay(r.retries.initialWait),
-		)
-	case EXPONENTIAL_BACKOFF:
-		return retrier.NewRetrier(
-			r.retries.retryCount,
-			retrier.ExponentialDelay(2, 2),
-		)
-	default:
-		return nil
-	}
-}
-
 func (r *_HttpRequest) Get() HTTPResponse {
-	r.method = "GET"
-	retrier := r.getRetrier()
-	if retrier == nil {
-		return r.doRequest()
-	}
-	var resp HTTPResponse
-	retrier.Run(func() (error, bool) {
-		resp = r.doRequest()
-		if resp.CatchError() != nil {
-			return resp.CatchError(), false
-		}
-		return nil, true
-	})
-	return resp
+	return r.execute("GET")
 }
 
 func (r *_HttpRequest) GetAsync() <-chan HTTPResponse {
@@ -281,20 +263,7 @@ func (r *_HttpRequest) GetAsync() <-chan HTTPResponse {
 }
 
 func (r *_HttpRequest) Put() HTTPResponse {
-	r.method = "PUT"
-	retrier := r.getRetrier()
-	if retrier == nil {
-		return r.doRequest()
-	}
-	var resp HTTPResponse
-	retrier.Run(func() (error, bool) {
-		resp = r.doRequest()
-		if resp.CatchError() != nil {
-			return resp.CatchError(), false
-		}
-		return nil, true
-	})
-	return resp
+	return r.execute("PUT")
 }
 
 func (r *_HttpRequest) PutAsync() <-chan HTTPResponse {
@@ -307,20 +276,7 @@ func (r *_HttpRequest) PutAsync() <-chan HTTPResponse {
 }
 
 func (r *_HttpRequest) Post() HTTPResponse {
-	r.method = "POST"
-	retrier := r.getRetrier()
-	if retrier == nil {
-		return r.doRequest()
-	}
-	var resp HTTPResponse
-	retrier.Run(func() (error, bool) {
-		resp = r.doRequest()
-		if resp.CatchError() != nil {
-			return resp.CatchError(), false
-		}
-		return nil, true
-	})
-	return resp
+	return r.execute("POST")
 }
 
 func (r *_HttpRequest) PostAsync() <-chan HTTPResponse {
@@ -333,20 +289,7 @@ func (r *_HttpRequest) PostAsync() <-chan HTTPResponse {
 }
 
 func (r *_HttpRequest) Patch() HTTPResponse {
-	r.method = "PATCH"
-	retrier := r.getRetrier()
-	if retrier == nil {
-		return r.doRequest()
-	}
-	var resp HTTPResponse
-	retrier.Run(func() (error, bool) {
-		resp = r.doRequest()
-		if resp.CatchError() != nil {
-			return resp.CatchError(), false
-		}
-		return nil, true
-	})
-	return resp
+	return r.execute("PATCH")
 }
 
 func (r *_HttpRequest) PatchAsync() <-chan HTTPResponse {
@@ -359,20 +302,7 @@ func (r *_HttpRequest) PatchAsync() <-chan HTTPResponse {
 }
 
 func (r *_HttpRequest) Del() HTTPResponse {
-	r.method = "DELETE"
-	retrier := r.getRetrier()
-	if retrier == nil {
-		return r.doRequest()
-	}
-	var resp HTTPResponse
-	retrier.Run(func() (error, bool) {
-		resp = r.doRequest()
-		if resp.CatchError() != nil {
-			return resp.CatchError(), false
-		}
-		return nil, true
-	})
-	return resp
+	return r.execute("DELETE")
 }
 
 func (r *_HttpRequest) DelAsync() <-chan HTTPResponse {
@@ -447,6 +377,9 @@ func (r *_HttpRequest) New(url string) HTTPRequest {
 	r.response = nil
 	r.resBody = nil
 	r.body = nil
+	r.bodyReader = nil
+	r.stream = false
+	r.outputFile = ""
 	r.err = nil
 	r.method = ""
 	r.querried = false
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"sync"
 	"testing"
@@ -254,31 +255,23 @@ func TestAfterHook(t *testing.T) {
 	assert.Nil(t, err)
 }
 
-// func TestErroneousHttpBeforeHook(t *testing.T) {
-// 	hook := func(req *http.Request) error {
-// 		return errors.New("error")
-// 	}
-// 	req := &_HttpRequest{
-// 		readOnlyUrl: "https://httpbin.org/get",
-// 		headers:     make(http.Header),
-// 		traces:      &clientTrace{},
-// 		client:      &http.Client{},
-// 		ctx:         context.TODO(),
-// 		httpHooks: &HTTPHook{
-// 			Before: []func(*http.Request) error{hook},
-// 			After:  make([]func(*http.Request, *http.Response, HTTPMetadata, error), 0, 2),
-// 		},
-// 	}
-// 	assert.Equal(t, 1, len(req.httpHooks.Before))
-// 	// req := Req("https://httpbin.org/get").AddBeforeHook(hook)
-// 	// assert.Equal(t, false, req.
-// 	res := req.Get()
-// 	assert.Equal(t, false, res.IsSuccess())
-// 	assert.Equal(t, -1, res.GetStatusCode())
-// 	err := res.CatchError()
-// 	assert.NotNil(t, err)
-// 	assert.Equal(t, "error", err.Error())
-// }
+func TestErroneousHttpBeforeHook(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	hook := func(req *http.Request) error {
+		return errors.New("error")
+	}
+	res := Req(srv.URL).AddBeforeHook(hook).Get()
+	assert.Equal(t, false, res.IsSuccess())
+	assert.Equal(t, -1, res.GetStatusCode())
+	err := res.CatchError()
+	assert.NotNil(t, err)
+	assert.Equal(t, "error", err.Error())
+	assert.False(t, called)
+}
 
 func TestGetResponseBody(t *testing.T) {
 	baseUrl := os.Getenv("HTTPBIN_URL")
@@ -1,7 +1,6 @@
 package httpclient
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,6 +20,7 @@ type HTTPResponse interface {
 	GetMethod() string
 	GetHeaders() http.Header
 	GetBody() []byte
+	GetBodyStream() io.ReadCloser
 	GetCookies() []*http.Cookie
 	GetElapsedTime() time.Duration
 	CURL() string
@@ -66,31 +66,28 @@ func (r *_HttpRequest) afterRequest() {
 }
 
 func (r *_HttpRequest) doRequest() HTTPResponse {
-	if r.withLock {
-		defer r.afterRequest()
-	}
-
 	if r.err != nil {
 		return r
 	}
 
 	var req *http.Request
 
-	if r.body != nil {
-		req, r.err = http.NewRequest(r.method, r.url, bytes.NewBuffer(r.body))
-	} else {
-		req, r.err = http.NewRequest(r.method, r.url, nil)
+	req, r.err = r.newRequest()
+	if r.err != nil {
+		r.statusCode = -1
+		return r
 	}
 
 	req = req.WithContext(r.traces.CreateContext(r.ctx))
 
-	req.Header = r.headers
+	// middlewares get their own copy so changes don't pile up across retries
+	req.Header = r.headers.Clone()
 	for _, cookie := range r.Cookies {
 		req.AddCookie(cookie)
 	}
 
 	r.startTime = time.Now()
-	r.response, r.err = r.client.Do(req)
+	r.response, r.err = r.roundTrip()(req)
 
 	endTime := time.Now()
 	for i := range r.httpHooks.After {
@@ -106,13 +103,7 @@ func (r *_HttpRequest) doRequest() HTTPResponse {
 	}
 
 	r.statusCode = r.response.StatusCode
-
-	r.resBody, r.err = io.ReadAll(r.response.Body)
-	if r.err != nil {
-		return r
-	}
-
-	r.response.Body.Close()
+	r.err = r.readBody()
 	return r
 }
 
@@ -192,7 +183,9 @@ func (r *_HttpRequest) CURL() string {
 		builder.WriteString(v[0])
 		builder.WriteString("'")
 	}
-	if r.body != nil {
+	if r.bodyReader != nil {
+		builder.WriteString(" --data-binary @-")
+	} else if r.body != nil {
 		builder.WriteString(" -d '")
 		b := string(r.body)
 		builder.WriteString(b)
@@ -201,12 +194,11 @@ func (r *_HttpRequest) CURL() string {
 	return builder.String()
 }
 
-// CleanUp cleans up the request object
+// CleanUp cleans up the request object, the connection goes back to the pool
 func (r *_HttpRequest) CleanUp() {
 	if r.response != nil && r.response.Body != nil {
 		r.response.Body.Close()
 	}
-	r.client.CloseIdleConnections()
 	r.resBody = nil
 	r.response = nil
 	r.err = nil
@@ -215,6 +207,7 @@ func (r *_HttpRequest) CleanUp() {
 	r.headers = http.Header{}
 	r.Cookies = nil
 	r.body = nil
+	r.bodyReader = nil
 	r.url = ""
 	r.method = ""
 	r.withLock = false
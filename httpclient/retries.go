@@ -1,5 +1,16 @@
 package httpclient
 
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
 type RetryPolicy int8
 
 const (
@@ -7,3 +18,209 @@ const (
 	EXPONENTIAL_BACKOFF RetryPolicy = iota
 	CONSTANT_BACKOFF    RetryPolicy = iota
 )
+
+const default_max_retry_delay = 30 * time.Second
+
+// DEFAULT_RETRY_STATUS_CODES are the statuses retried when no condition is configured
+var DEFAULT_RETRY_STATUS_CODES = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooEarly,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryCondition reports whether a finished attempt should be retried
+type RetryCondition func(res HTTPResponse) bool
+
+// RetryOnStatus retries the attempts that ended with one of the given status codes
+func RetryOnStatus(codes ...int) RetryCondition {
+	return func(res HTTPResponse) bool {
+		for _, code := range codes {
+			if res.GetStatusCode() == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RetryOnNetworkError retries the attempts that failed to get a response,
+// cancelled contexts are never retried
+func RetryOnNetworkError() RetryCondition {
+	return func(res HTTPResponse) bool {
+		err := res.CatchError()
+		var urlErr *url.Error
+		return res.GetStatusCode() == -1 &&
+			errors.As(err, &urlErr) &&
+			!errors.Is(err, context.Canceled) &&
+			!errors.Is(err, context.DeadlineExceeded)
+	}
+}
+
+// RetryConfig configures how a request is retried
+// params:
+//   - Policy: EXPONENTIAL_BACKOFF doubles Delay after each attempt, CONSTANT_BACKOFF keeps it
+//   - MaxRetries: retries after the first attempt
+//   - Delay: delay before the first retry
+//   - MaxDelay: cap of a single delay, defaults to 30 seconds, a response asking to
+//     wait longer with Retry-After is returned instead of retrying it sooner than asked
+//   - Jitter: fraction of the delay randomly taken off, between 0 and 1
+//   - MaxElapsed: no retry starts after this much time since the first attempt, no cap when 0
+//   - Conditions: an attempt is retried when one matches, defaults to network errors
+//     and DEFAULT_RETRY_STATUS_CODES
+//   - IgnoreRetryAfter: ignore the Retry-After header of the responses
+//   - RetryNonIdempotent: retry POST and PATCH requests, they are retried anyway
+//     when they carry an Idempotency-Key header
+//   - OnRetry: called before each retry with the failed attempt and the delay
+type RetryConfig struct {
+	Policy             RetryPolicy
+	MaxRetries         int
+	Delay              time.Duration
+	MaxDelay           time.Duration
+	Jitter             float64
+	MaxElapsed         time.Duration
+	Conditions         []RetryCondition
+	IgnoreRetryAfter   bool
+	RetryNonIdempotent bool
+	OnRetry            func(attempt int, res HTTPResponse, delay time.Duration)
+}
+
+// shouldRetry reports whether the attempt matches one of the conditions
+func (cfg *RetryConfig) shouldRetry(res HTTPResponse) bool {
+	conditions := cfg.Conditions
+	if len(conditions) == 0 {
+		conditions = []RetryCondition{
+			RetryOnNetworkError(),
+			RetryOnStatus(DEFAULT_RETRY_STATUS_CODES...),
+		}
+	}
+	for _, condition := range conditions {
+		if condition(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxDelay returns the cap of a single delay
+func (cfg *RetryConfig) maxDelay() time.Duration {
+	if cfg.MaxDelay <= 0 {
+		return default_max_retry_delay
+	}
+	return cfg.MaxDelay
+}
+
+// backoff returns the delay before the given retry, counted from 1
+func (cfg *RetryConfig) backoff(retry int) time.Duration {
+	maxDelay := cfg.maxDelay()
+	delay := cfg.Delay
+	if cfg.Policy == EXPONENTIAL_BACKOFF {
+		delay = time.Duration(float64(delay) * math.Pow(2, float64(retry-1)))
+	}
+	if delay > maxDelay || delay < 0 {
+		delay = maxDelay
+	}
+	if cfg.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * math.Min(cfg.Jitter, 1) * float64(delay))
+	}
+	return delay
+}
+
+// isIdempotent reports whether the method can safely be sent twice
+func isIdempotent(method string, headers http.Header) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch:
+		return headers.Get("Idempotency-Key") != ""
+	}
+	return true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a http date
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// WithRetryPolicy retries the request according to the given config
+func (r *_HttpRequest) WithRetryPolicy(config *RetryConfig) HTTPRequest {
+	r.retry = config
+	return r
+}
+
+// execute sends the request with the given method, retrying it according to its policy,
+// bodies read from a reader that can't seek are sent once
+func (r *_HttpRequest) execute(method string) HTTPResponse {
+	if r.withLock {
+		defer r.afterRequest()
+	}
+	r.method = method
+	cfg := r.retry
+	if r.err != nil || cfg == nil || cfg.Policy == NO_RETRY || cfg.MaxRetries <= 0 ||
+		(!cfg.RetryNonIdempotent && !isIdempotent(method, r.headers)) || !r.replayable() {
+		return r.doRequest()
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := time.Now()
+	for retry := 1; ; retry++ {
+		r.doRequest()
+		if retry > cfg.MaxRetries || !cfg.shouldRetry(r) {
+			return r
+		}
+		delay := cfg.backoff(retry)
+		if !cfg.IgnoreRetryAfter {
+			if d, ok := retryAfter(r.response, time.Now()); ok {
+				// retrying before the server asked would only be refused again
+				if d > cfg.maxDelay() {
+					return r
+				}
+				delay = d
+			}
+		}
+		if cfg.MaxElapsed > 0 && time.Since(start)+delay > cfg.MaxElapsed {
+			return r
+		}
+		if cfg.OnRetry != nil {
+			cfg.OnRetry(retry, r, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return r
+		case <-timer.C:
+		}
+		r.resetAttempt()
+	}
+}
+
+// resetAttempt clears the outcome of the previous attempt before a retry
+func (r *_HttpRequest) resetAttempt() {
+	if r.response != nil && r.response.Body != nil {
+		r.response.Body.Close()
+	}
+	r.err = nil
+	r.statusCode = 0
+	r.response = nil
+	r.resBody = nil
+}
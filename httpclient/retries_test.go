@@ -0,0 +1,203 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyServer fails the first n requests with status
+func flakyServer(n int32, status int, header http.Header) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= n {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return srv, &calls
+}
+
+func TestRetryOnStatus(t *testing.T) {
+	srv, calls := flakyServer(2, http.StatusServiceUnavailable, nil)
+	defer srv.Close()
+	delays := []time.Duration{}
+	res := Req(srv.URL).WithRetryPolicy(&RetryConfig{
+		Policy:     EXPONENTIAL_BACKOFF,
+		MaxRetries: 3,
+		Delay:      time.Millisecond,
+		OnRetry: func(attempt int, res HTTPResponse, delay time.Duration) {
+			assert.Equal(t, http.StatusServiceUnavailable, res.GetStatusCode())
+			delays = append(delays, delay)
+		},
+	}).Get()
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, "ok", string(res.GetBody()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	// the delay grows from the configured amount
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, delays)
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	srv, calls := flakyServer(5, http.StatusBadRequest, nil)
+	defer srv.Close()
+	res := Req(srv.URL).WithRetries(CONSTANT_BACKOFF, 3, time.Millisecond).Get()
+	assert.Equal(t, http.StatusBadRequest, res.GetStatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	res = Req(srv.URL).WithRetryPolicy(&RetryConfig{
+		Policy:     CONSTANT_BACKOFF,
+		MaxRetries: 2,
+		Delay:      time.Millisecond,
+		Conditions: []RetryCondition{RetryOnStatus(http.StatusBadRequest)},
+	}).Get()
+	assert.Equal(t, http.StatusBadRequest, res.GetStatusCode())
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+}
+
+func TestRetryIdempotency(t *testing.T) {
+	srv, calls := flakyServer(100, http.StatusBadGateway, nil)
+	defer srv.Close()
+	Req(srv.URL).WithRetries(CONSTANT_BACKOFF, 2, time.Millisecond).Post()
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	Req(srv.URL).AddHeader("Idempotency-Key", "abc").
+		WithRetries(CONSTANT_BACKOFF, 2, time.Millisecond).Post()
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+
+	Req(srv.URL).WithRetryPolicy(&RetryConfig{
+		Policy:             CONSTANT_BACKOFF,
+		MaxRetries:         2,
+		Delay:              time.Millisecond,
+		RetryNonIdempotent: true,
+	}).Patch()
+	assert.Equal(t, int32(7), atomic.LoadInt32(calls))
+}
+
+func TestRetryAfterAndMaxElapsed(t *testing.T) {
+	srv, calls := flakyServer(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+	defer srv.Close()
+	res := Req(srv.URL).WithRetries(CONSTANT_BACKOFF, 1, time.Hour).Get()
+	// the server asked to retry right away
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+	srv, calls = flakyServer(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+	defer srv.Close()
+	start := time.Now()
+	res = Req(srv.URL).WithRetryPolicy(&RetryConfig{
+		Policy:     CONSTANT_BACKOFF,
+		MaxRetries: 3,
+		Delay:      time.Millisecond,
+		MaxElapsed: time.Second,
+	}).Get()
+	assert.Equal(t, http.StatusTooManyRequests, res.GetStatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryAfterAboveMaxDelay(t *testing.T) {
+	srv, calls := flakyServer(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"3600"}})
+	defer srv.Close()
+	retried := false
+	start := time.Now()
+	res := Req(srv.URL).WithRetryPolicy(&RetryConfig{
+		Policy:     CONSTANT_BACKOFF,
+		MaxRetries: 3,
+		Delay:      time.Millisecond,
+		MaxDelay:   time.Second,
+		OnRetry: func(attempt int, res HTTPResponse, delay time.Duration) {
+			retried = true
+		},
+	}).Get()
+	// the server asked for longer than MaxDelay, the response is returned as is
+	assert.Equal(t, http.StatusServiceUnavailable, res.GetStatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.False(t, retried)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// without MaxDelay the default of 30 seconds applies
+	srv, calls = flakyServer(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"31"}})
+	defer srv.Close()
+	res = Req(srv.URL).WithRetries(CONSTANT_BACKOFF, 3, time.Millisecond).Get()
+	assert.Equal(t, http.StatusServiceUnavailable, res.GetStatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// IgnoreRetryAfter keeps retrying on the computed delay
+	srv, calls = flakyServer(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"3600"}})
+	defer srv.Close()
+	res = Req(srv.URL).WithRetryPolicy(&RetryConfig{
+		Policy:           CONSTANT_BACKOFF,
+		MaxRetries:       1,
+		Delay:            time.Millisecond,
+		IgnoreRetryAfter: true,
+	}).Get()
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryOnNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	attempts := 0
+	res := Req(url).WithRetryPolicy(&RetryConfig{
+		Policy:     CONSTANT_BACKOFF,
+		MaxRetries: 2,
+		Delay:      time.Millisecond,
+		OnRetry: func(attempt int, res HTTPResponse, delay time.Duration) {
+			attempts = attempt
+		},
+	}).Begin().Get()
+	assert.Equal(t, -1, res.GetStatusCode())
+	assert.NotNil(t, res.CatchError())
+	assert.Equal(t, 2, attempts)
+
+	// errors of before hooks are not network errors
+	attempts = 0
+	Req(url).WithRetries(CONSTANT_BACKOFF, 2, time.Millisecond).
+		AddBeforeHook(func(req *http.Request) error { return assert.AnError }).Get()
+	assert.Equal(t, 0, attempts)
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := &RetryConfig{Policy: EXPONENTIAL_BACKOFF, Delay: 100 * time.Millisecond, MaxDelay: time.Second}
+	assert.Equal(t, 100*time.Millisecond, cfg.backoff(1))
+	assert.Equal(t, 400*time.Millisecond, cfg.backoff(3))
+	assert.Equal(t, time.Second, cfg.backoff(10))
+	assert.Equal(t, time.Second, cfg.backoff(100))
+	cfg.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := cfg.backoff(1)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+	constant := &RetryConfig{Policy: CONSTANT_BACKOFF, Delay: 100 * time.Millisecond}
+	assert.Equal(t, 100*time.Millisecond, constant.backoff(5))
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := &http.Response{Header: http.Header{}}
+	_, ok := retryAfter(res, now)
+	assert.False(t, ok)
+	res.Header.Set("Retry-After", "3")
+	d, ok := retryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+	res.Header.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	d, ok = retryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+	res.Header.Set("Retry-After", "soon")
+	_, ok = retryAfter(res, now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ProgressFunc is called as a body is transferred, total is -1 when the size is unknown
+type ProgressFunc func(transferred int64, total int64)
+
+// AddBodyReader sends the body from a reader instead of holding it in memory,
+// the request is only retried when the reader is an io.Seeker
+// params:
+//   - body: reader of the body, the caller keeps closing it
+//   - size: length of the body, -1 when unknown so the body is sent chunked
+func (r *_HttpRequest) AddBodyReader(body io.Reader, size int64) HTTPRequest {
+	r.body = nil
+	r.bodyReader = body
+	r.bodySize = size
+	r.bodyOffset = 0
+	if seeker, ok := body.(io.Seeker); ok {
+		r.bodyOffset, _ = seeker.Seek(0, io.SeekCurrent)
+	}
+	return r
+}
+
+// Stream leaves the response body open instead of reading it in memory, whatever
+// the status, it is read with GetBodyStream and must be closed or handed back with CleanUp
+func (r *_HttpRequest) Stream() HTTPRequest {
+	r.stream = true
+	return r
+}
+
+// WithOutputFile writes the body of a successful response to the file at path,
+// the file is only replaced once the whole body was received, error bodies are
+// read in memory as usual so they can be caught
+func (r *_HttpRequest) WithOutputFile(path string) HTTPRequest {
+	r.outputFile = path
+	return r
+}
+
+// WithUploadProgress reports the bytes of the request body sent so far
+func (r *_HttpRequest) WithUploadProgress(fn ProgressFunc) HTTPRequest {
+	r.uploadProgress = fn
+	return r
+}
+
+// WithDownloadProgress reports the bytes of the response body received so far
+func (r *_HttpRequest) WithDownloadProgress(fn ProgressFunc) HTTPRequest {
+	r.downloadProgress = fn
+	return r
+}
+
+// GetBodyStream returns the live response body of a streamed request, nil otherwise
+func (r *_HttpRequest) GetBodyStream() io.ReadCloser {
+	if !r.stream || r.response == nil {
+		return nil
+	}
+	return r.response.Body
+}
+
+// replayable reports whether the body can be sent again by a retry
+func (r *_HttpRequest) replayable() bool {
+	if r.bodyReader == nil {
+		return true
+	}
+	_, ok := r.bodyReader.(io.Seeker)
+	return ok
+}
+
+// newRequest builds the http request of an attempt, a seekable body reader is
+// rewound so retries send it whole
+func (r *_HttpRequest) newRequest() (*http.Request, error) {
+	var body io.Reader
+	size := int64(-1)
+	switch {
+	case r.bodyReader != nil:
+		if seeker, ok := r.bodyReader.(io.Seeker); ok {
+			if _, err := seeker.Seek(r.bodyOffset, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		// the transport must not close it, retries may send it again
+		body, size = io.NopCloser(r.bodyReader), r.bodySize
+	case r.body != nil:
+		body, size = bytes.NewReader(r.body), int64(len(r.body))
+	}
+	if body != nil && r.uploadProgress != nil {
+		body = &progressReader{r: body, total: size, fn: r.uploadProgress}
+	}
+	req, err := http.NewRequest(r.method, r.url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	return req, nil
+}
+
+// readBody consumes the response body according to the request mode
+func (r *_HttpRequest) readBody() error {
+	if r.downloadProgress != nil {
+		r.response.Body = &progressReadCloser{
+			progressReader: progressReader{
+				r:     r.response.Body,
+				total: r.response.ContentLength,
+				fn:    r.downloadProgress,
+			},
+			c: r.response.Body,
+		}
+	}
+	if r.stream {
+		return nil
+	}
+	defer r.response.Body.Close()
+	if r.outputFile != "" && r.IsSuccess() {
+		return download(r.response.Body, r.outputFile)
+	}
+	var err error
+	r.resBody, err = io.ReadAll(r.response.Body)
+	return err
+}
+
+// download writes body to a temporary file next to path and moves it in place
+func download(body io.Reader, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.part")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+type progressReader struct {
+	r     io.Reader
+	total int64
+	n     int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.fn(p.n, p.total)
+	}
+	return n, err
+}
+
+type progressReadCloser struct {
+	progressReader
+	c io.Closer
+}
+
+func (p *progressReadCloser) Close() error {
+	return p.c.Close()
+}
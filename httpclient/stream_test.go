@@ -0,0 +1,133 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bodyEchoServer answers with the length, content length, transfer encoding and
+// content of the body it received
+func bodyEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(strconv.Itoa(len(body)) + ":" + strconv.FormatInt(r.ContentLength, 10) +
+			":" + strings.Join(r.TransferEncoding, ",") + ":" + string(body)))
+	}))
+}
+
+func TestAddBodyReader(t *testing.T) {
+	srv := bodyEchoServer()
+	defer srv.Close()
+	var sent, total int64
+	res := Req(srv.URL).AddBodyReader(strings.NewReader("hello"), 5).
+		WithUploadProgress(func(transferred, size int64) {
+			sent, total = transferred, size
+		}).Post()
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, "5:5::hello", string(res.GetBody()))
+	assert.Equal(t, int64(5), sent)
+	assert.Equal(t, int64(5), total)
+
+	// unknown sizes are sent chunked
+	res = Req(srv.URL).AddBodyReader(io.MultiReader(strings.NewReader("hel"), strings.NewReader("lo")), -1).Put()
+	assert.Equal(t, "5:-1:chunked:hello", string(res.GetBody()))
+
+	res = Req(srv.URL).AddBodyReader(strings.NewReader(""), 0).Put()
+	assert.Equal(t, "0:0::", string(res.GetBody()))
+}
+
+func TestBodyReaderRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+	body := strings.NewReader("skip:payload")
+	body.Seek(5, io.SeekStart)
+	res := Req(srv.URL).AddBodyReader(body, 7).
+		WithRetries(CONSTANT_BACKOFF, 1, time.Millisecond).Put()
+	// the reader is rewound to where it was given
+	assert.Equal(t, "payload", string(res.GetBody()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// readers that can't seek are sent once
+	atomic.StoreInt32(&calls, 0)
+	res = Req(srv.URL).AddBodyReader(io.LimitReader(strings.NewReader("payload"), 7), 7).
+		WithRetries(CONSTANT_BACKOFF, 1, time.Millisecond).Put()
+	assert.Equal(t, http.StatusServiceUnavailable, res.GetStatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestStream(t *testing.T) {
+	payload := strings.Repeat("x", 1<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		io.WriteString(w, payload)
+	}))
+	defer srv.Close()
+	var received, total int64
+	res := Req(srv.URL).Stream().WithDownloadProgress(func(transferred, size int64) {
+		received, total = transferred, size
+	}).Get()
+	assert.True(t, res.IsSuccess())
+	assert.Nil(t, res.GetBody())
+	stream := res.GetBodyStream()
+	assert.NotNil(t, stream)
+	n, err := io.Copy(io.Discard, stream)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(payload)), n)
+	assert.Equal(t, int64(len(payload)), received)
+	assert.Equal(t, int64(len(payload)), total)
+	res.CleanUp()
+
+	res = Req(srv.URL).Get()
+	assert.Nil(t, res.GetBodyStream())
+	assert.Equal(t, len(payload), len(res.GetBody()))
+}
+
+func TestWithOutputFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+			return
+		}
+		w.Write([]byte("report"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+
+	res := Req(srv.URL + "/report").WithOutputFile(path).Get()
+	assert.True(t, res.IsSuccess())
+	assert.Nil(t, res.GetBody())
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "report", string(content))
+
+	// error bodies are kept for Catch and the file is left untouched
+	res = Req(srv.URL + "/missing").WithOutputFile(path).Get()
+	assert.Equal(t, http.StatusNotFound, res.GetStatusCode())
+	body := map[string]string{}
+	assert.Nil(t, res.Catch(&body))
+	assert.Equal(t, "not found", body["error"])
+	content, _ = os.ReadFile(path)
+	assert.Equal(t, "report", string(content))
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the go implementations below mirror the lua scripts of redis.go, times are in milliseconds
+
+// bucketState is the state of a token bucket
+type bucketState struct {
+	tokens float64
+	last   int64
+}
+
+// takeTokens refills the bucket up to now and takes n tokens when there are enough
+func takeTokens(
+	state bucketState,
+	found bool,
+	now int64,
+	opts LimiterOptions,
+	n int64,
+) (bucketState, Result) {
+	rate := float64(opts.Limit) / float64(opts.Period.Milliseconds())
+	burst := float64(opts.Burst)
+	if !found {
+		state = bucketState{tokens: burst, last: now}
+	}
+	if now > state.last {
+		state.tokens = math.Min(burst, state.tokens+float64(now-state.last)*rate)
+		state.last = now
+	}
+	if state.tokens < float64(n) {
+		retry := int64(math.Ceil((float64(n) - state.tokens) / rate))
+		return state, Result{
+			Remaining:  int64(state.tokens),
+			RetryAfter: time.Duration(retry) * time.Millisecond,
+		}
+	}
+	state.tokens -= float64(n)
+	return state, Result{Allowed: true, Remaining: int64(state.tokens)}
+}
+
+// bucketTTL is how long a bucket takes to fill up, an older bucket is the same as a new one
+func bucketTTL(opts LimiterOptions) time.Duration {
+	return time.Duration(opts.Burst) * opts.Period / time.Duration(opts.Limit)
+}
+
+func (s bucketState) encode() string {
+	return strconv.FormatFloat(s.tokens, 'g', -1, 64) + ":" + strconv.FormatInt(s.last, 10)
+}
+
+func decodeBucketState(value string) (bucketState, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return bucketState{}, fmt.Errorf("ratelimit: invalid token bucket state %q", value)
+	}
+	tokens, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return bucketState{}, err
+	}
+	last, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return bucketState{}, err
+	}
+	return bucketState{tokens: tokens, last: last}, nil
+}
+
+// windowState holds the counts of the current and the previous fixed windows
+type windowState struct {
+	window int64
+	prev   int64
+	curr   int64
+}
+
+// slideWindow counts n requests when the estimated count of the sliding window allows it
+func slideWindow(
+	state windowState,
+	found bool,
+	now int64,
+	opts LimiterOptions,
+	n int64,
+) (windowState, Result) {
+	period := opts.Period.Milliseconds()
+	window := now / period
+	switch {
+	case !found || state.window < window-1:
+		state = windowState{window: window}
+	case state.window == window-1:
+		state = windowState{window: window, prev: state.curr}
+	}
+	elapsed := float64(now-window*period) / float64(period)
+	estimate := float64(state.prev)*(1-elapsed) + float64(state.curr)
+	limit := float64(opts.Limit)
+	if estimate+float64(n) > limit {
+		var at float64
+		if state.curr+n <= opts.Limit {
+			// wait for the previous window to slide out enough
+			at = float64(window*period) + math.Ceil((1-float64(opts.Limit-state.curr-n)/float64(state.prev))*float64(period))
+		} else {
+			// wait for the next window, where the current count becomes the previous one
+			at = float64((window+1)*period) + math.Ceil((1-float64(opts.Limit-n)/float64(state.curr))*float64(period))
+		}
+		retry := int64(at) - now
+		if retry < 1 {
+			retry = 1
+		}
+		return state, Result{
+			Remaining:  remaining(limit - estimate),
+			RetryAfter: time.Duration(retry) * time.Millisecond,
+		}
+	}
+	state.curr += n
+	return state, Result{Allowed: true, Remaining: remaining(limit - estimate - float64(n))}
+}
+
+func remaining(v float64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return int64(v)
+}
+
+// windowTTL keeps the state while it still weighs on the sliding window
+func windowTTL(opts LimiterOptions) time.Duration {
+	return 2 * opts.Period
+}
+
+func (s windowState) encode() string {
+	return strconv.FormatInt(s.window, 10) + ":" +
+		strconv.FormatInt(s.prev, 10) + ":" +
+		strconv.FormatInt(s.curr, 10)
+}
+
+func decodeWindowState(value string) (windowState, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return windowState{}, fmt.Errorf("ratelimit: invalid sliding window state %q", value)
+	}
+	nums := [3]int64{}
+	for i, part := range parts {
+		num, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return windowState{}, err
+		}
+		nums[i] = num
+	}
+	return windowState{window: nums[0], prev: nums[1], curr: nums[2]}, nil
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/karim-w/stdlib/caching"
+)
+
+// max_cas_attempts bounds the compare and swap retries of a single check
+const max_cas_attempts = 100
+
+// cacheBackend keeps the state as a string and updates it with compare and swap
+type cacheBackend struct {
+	cache caching.Cache
+	opts  LimiterOptions
+}
+
+func (b *cacheBackend) allow(
+	ctx context.Context,
+	key string,
+	n int64,
+	now time.Time,
+) (Result, error) {
+	for attempt := 0; attempt < max_cas_attempts; attempt++ {
+		current, err := b.cache.GetCtx(ctx, key)
+		found := err == nil
+		if err != nil && err != caching.Err_KEY_NOT_FOUND {
+			return Result{}, err
+		}
+		encoded := ""
+		if found {
+			encoded = fmt.Sprint(current)
+		}
+		next, res, ttl, err := b.apply(encoded, found, now.UnixMilli(), n)
+		if err != nil {
+			return Result{}, err
+		}
+		// a denied request leaves the state untouched
+		if !res.Allowed {
+			return res, nil
+		}
+		var ok bool
+		if found {
+			ok, err = b.cache.CompareAndSwapCtx(ctx, key, encoded, next, ttl)
+		} else {
+			ok, err = b.cache.SetIfAbsentCtx(ctx, key, next, ttl)
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		if ok {
+			return res, nil
+		}
+		// another caller updated the state first, start over with a fresh clock
+		now = time.Now()
+	}
+	return Result{}, Err_TOO_MUCH_CONTENTION
+}
+
+// apply runs the algorithm on the encoded state and returns the new encoded state
+func (b *cacheBackend) apply(
+	encoded string,
+	found bool,
+	now int64,
+	n int64,
+) (string, Result, time.Duration, error) {
+	if b.opts.Algorithm == SLIDING_WINDOW_ALGORITHM {
+		var state windowState
+		if found {
+			var err error
+			if state, err = decodeWindowState(encoded); err != nil {
+				return "", Result{}, 0, err
+			}
+		}
+		state, res := slideWindow(state, found, now, b.opts, n)
+		return state.encode(), res, windowTTL(b.opts), nil
+	}
+	var state bucketState
+	if found {
+		var err error
+		if state, err = decodeBucketState(encoded); err != nil {
+			return "", Result{}, 0, err
+		}
+	}
+	state, res := takeTokens(state, found, now, b.opts, n)
+	return state.encode(), res, bucketTTL(b.opts), nil
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/karim-w/stdlib/caching"
+)
+
+var (
+	Err_INVALID_LIMITER_OPTIONS = fmt.Errorf("invalid rate limiter options")
+	Err_REQUEST_EXCEEDS_LIMIT   = fmt.Errorf("request exceeds the rate limit")
+	Err_TOO_MUCH_CONTENTION     = fmt.Errorf("rate limit state changed too often to be updated")
+)
+
+// Algorithm selects how requests are counted
+type Algorithm string
+
+const (
+	// TOKEN_BUCKET_ALGORITHM refills Limit tokens every Period up to Burst, it allows short bursts
+	TOKEN_BUCKET_ALGORITHM Algorithm = "TokenBucket"
+	// SLIDING_WINDOW_ALGORITHM allows Limit requests in any Period, the previous window is
+	// weighted by how much of it still overlaps the sliding window
+	SLIDING_WINDOW_ALGORITHM Algorithm = "SlidingWindow"
+)
+
+// LimiterOptions configures a Limiter
+// params:
+//   - Algorithm: counting algorithm, defaults to TOKEN_BUCKET_ALGORITHM
+//   - Limit: number of requests allowed per Period, required
+//   - Period: length of the window, required, at least a millisecond
+//   - Burst: capacity of the token bucket, defaults to Limit
+//   - Prefix: prefix of the cache keys, defaults to "ratelimit"
+type LimiterOptions struct {
+	Algorithm Algorithm
+	Limit     int64
+	Period    time.Duration
+	Burst     int64
+	Prefix    string
+}
+
+// Result is the outcome of a rate limit check
+// params:
+//   - Allowed: whether the request may proceed
+//   - Remaining: requests that would still be allowed right now
+//   - RetryAfter: how long to wait before the request can be allowed, 0 when allowed
+type Result struct {
+	Allowed    bool
+	Remaining  int64
+	RetryAfter time.Duration
+}
+
+// Limiter throttles requests per key, e.g. per tenant
+type Limiter interface {
+	// Allow reports whether one request for the key may proceed
+	Allow(ctx context.Context, key string) (bool, error)
+	// AllowN reports whether n requests for the key may proceed at once
+	AllowN(ctx context.Context, key string, n int64) (Result, error)
+	// Wait blocks until one request for the key is allowed or the context is done
+	Wait(ctx context.Context, key string) error
+	// WaitN blocks until n requests for the key are allowed or the context is done
+	WaitN(ctx context.Context, key string, n int64) error
+}
+
+// backend applies the algorithm atomically for a key
+type backend interface {
+	allow(ctx context.Context, key string, n int64, now time.Time) (Result, error)
+}
+
+type limiterImpl struct {
+	backend backend
+	opts    LimiterOptions
+}
+
+// NewLimiter returns a limiter keeping its counters in the cache
+// redis and two tier caches run atomic lua scripts on redis, other caches retry
+// compare and swap updates, replicas sharing a redis should have synchronized clocks,
+// counters are kept within the name and version of the cache
+// params:
+//   - c: cache
+//   - opts: limiter options
+//
+// returns:
+//   - Limiter: limiter
+//   - error: error if any
+func NewLimiter(c caching.Cache, opts *LimiterOptions) (Limiter, error) {
+	if c == nil || opts == nil || opts.Limit <= 0 ||
+		opts.Period < time.Millisecond || opts.Burst < 0 {
+		return nil, Err_INVALID_LIMITER_OPTIONS
+	}
+	cfg := *opts
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = TOKEN_BUCKET_ALGORITHM
+	}
+	if cfg.Algorithm != TOKEN_BUCKET_ALGORITHM && cfg.Algorithm != SLIDING_WINDOW_ALGORITHM {
+		return nil, Err_INVALID_LIMITER_OPTIONS
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = cfg.Limit
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "ratelimit"
+	}
+	l := &limiterImpl{opts: cfg}
+	if client, ok := caching.RedisClient(c); ok {
+		l.backend = &redisBackend{client: client, prefix: caching.KeyPrefix(c), opts: cfg}
+	} else {
+		l.backend = &cacheBackend{cache: c, opts: cfg}
+	}
+	return l, nil
+}
+
+func (l *limiterImpl) Allow(ctx context.Context, key string) (bool, error) {
+	res, err := l.AllowN(ctx, key, 1)
+	return res.Allowed, err
+}
+
+func (l *limiterImpl) AllowN(ctx context.Context, key string, n int64) (Result, error) {
+	if n <= 0 || n > l.capacity() {
+		return Result{}, Err_REQUEST_EXCEEDS_LIMIT
+	}
+	return l.backend.allow(ctx, l.opts.Prefix+":"+key, n, time.Now())
+}
+
+func (l *limiterImpl) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+func (l *limiterImpl) WaitN(ctx context.Context, key string, n int64) error {
+	for {
+		res, err := l.AllowN(ctx, key, n)
+		if err != nil {
+			return err
+		}
+		if res.Allowed {
+			return nil
+		}
+		timer := time.NewTimer(res.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// capacity is the most requests a single call can ask for
+func (l *limiterImpl) capacity() int64 {
+	if l.opts.Algorithm == TOKEN_BUCKET_ALGORITHM {
+		return l.opts.Burst
+	}
+	return l.opts.Limit
+}
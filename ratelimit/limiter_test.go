@@ -0,0 +1,209 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/karim-w/stdlib/caching"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRedisURI returns REDIS_URI, or the uri of an in-process miniredis when it is not set
+func testRedisURI(t *testing.T) string {
+	if uri := os.Getenv("REDIS_URI"); uri != "" {
+		return uri
+	}
+	return "redis://" + miniredis.RunT(t).Addr()
+}
+
+func TestInvalidOptions(t *testing.T) {
+	c := caching.InitMemoryCache(time.Minute, time.Minute)
+	_, err := NewLimiter(c, nil)
+	assert.Equal(t, Err_INVALID_LIMITER_OPTIONS, err)
+	_, err = NewLimiter(c, &LimiterOptions{Limit: 1})
+	assert.Equal(t, Err_INVALID_LIMITER_OPTIONS, err)
+	_, err = NewLimiter(c, &LimiterOptions{Limit: 1, Period: time.Second, Algorithm: "fixed"})
+	assert.Equal(t, Err_INVALID_LIMITER_OPTIONS, err)
+	l, err := NewLimiter(c, &LimiterOptions{Limit: 2, Period: time.Second})
+	assert.Nil(t, err)
+	_, err = l.AllowN(context.Background(), "tenant", 3)
+	assert.Equal(t, Err_REQUEST_EXCEEDS_LIMIT, err)
+}
+
+func TestTakeTokens(t *testing.T) {
+	opts := LimiterOptions{Limit: 10, Period: time.Second, Burst: 5}
+	state, res := takeTokens(bucketState{}, false, 0, opts, 5)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	state, res = takeTokens(state, true, 50, opts, 1)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 50*time.Millisecond, res.RetryAfter)
+	// refilled at 10 tokens per second, capped at the burst
+	_, res = takeTokens(state, true, 10000, opts, 1)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(4), res.Remaining)
+}
+
+func TestSlideWindow(t *testing.T) {
+	opts := LimiterOptions{Limit: 10, Period: time.Second}
+	state, res := slideWindow(windowState{}, false, 500, opts, 10)
+	assert.True(t, res.Allowed)
+	state, res = slideWindow(state, true, 900, opts, 1)
+	assert.False(t, res.Allowed)
+	// the next window still weighs the 10 requests of the previous one
+	assert.Equal(t, 200*time.Millisecond, res.RetryAfter)
+	_, res = slideWindow(state, true, 1050, opts, 1)
+	assert.False(t, res.Allowed)
+	state, res = slideWindow(state, true, 1200, opts, 2)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	_, res = slideWindow(state, true, 3000, opts, 10)
+	assert.True(t, res.Allowed)
+}
+
+func testLimiter(t *testing.T, c caching.Cache, algorithm Algorithm) {
+	ctx := context.Background()
+	l, err := NewLimiter(c, &LimiterOptions{
+		Algorithm: algorithm,
+		Limit:     5,
+		Period:    time.Hour,
+		Prefix:    "ratelimit_test_" + string(algorithm),
+	})
+	assert.Nil(t, err)
+	var allowed int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := l.Allow(ctx, "tenant")
+			assert.Nil(t, err)
+			if ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), allowed)
+	res, err := l.AllowN(ctx, "tenant", 1)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+	// keys are limited independently
+	ok, err := l.Allow(ctx, "other")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	testLimiter(t, caching.InitMemoryCache(time.Minute, time.Minute), TOKEN_BUCKET_ALGORITHM)
+	testLimiter(t, caching.InitMemoryCache(time.Minute, time.Minute), SLIDING_WINDOW_ALGORITHM)
+}
+
+func TestDiskLimiter(t *testing.T) {
+	c, err := caching.InitDiskCache(filepath.Join(t.TempDir(), "cache.db"), nil)
+	assert.Nil(t, err)
+	defer c.Close()
+	testLimiter(t, c, TOKEN_BUCKET_ALGORITHM)
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLimiter(caching.InitMemoryCache(time.Minute, time.Minute), &LimiterOptions{
+		Limit:  1,
+		Period: 20 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, l.Wait(ctx, "tenant"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(timeout, "tenant"))
+}
+
+func TestRedisLimiter(t *testing.T) {
+	redisUri := testRedisURI(t)
+	c, err := caching.InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	defer c.Close()
+	client, _ := caching.RedisClient(c)
+	assert.Nil(t, client.Del(context.Background(),
+		"ratelimit_test_TokenBucket:tenant", "ratelimit_test_TokenBucket:other",
+		"ratelimit_test_SlidingWindow:tenant", "ratelimit_test_SlidingWindow:other",
+	).Err())
+	testLimiter(t, c, TOKEN_BUCKET_ALGORITHM)
+	testLimiter(t, c, SLIDING_WINDOW_ALGORITHM)
+}
+
+// TestRedisMatchesMemory replays the same calls on both backends, the lua scripts
+// must take the same decisions as their go counterparts
+func TestRedisMatchesMemory(t *testing.T) {
+	redisUri := testRedisURI(t)
+	ctx := context.Background()
+	c, err := caching.InitRedisCache(redisUri)
+	assert.Nil(t, err)
+	defer c.Close()
+	client, _ := caching.RedisClient(c)
+	for _, algorithm := range []Algorithm{TOKEN_BUCKET_ALGORITHM, SLIDING_WINDOW_ALGORITHM} {
+		opts := LimiterOptions{Algorithm: algorithm, Limit: 7, Period: time.Second, Burst: 4}
+		key := "ratelimit_parity_" + string(algorithm)
+		assert.Nil(t, client.Del(ctx, key).Err())
+		redisBackend := &redisBackend{client: client, opts: opts}
+		memBackend := &cacheBackend{cache: caching.InitMemoryCache(time.Minute, time.Minute), opts: opts}
+		base := time.UnixMilli(1_700_000_000_000)
+		for i, step := range []int64{0, 10, 20, 30, 40, 300, 310, 900, 1000, 1100, 1500, 2600, 2610, 2620} {
+			now := base.Add(time.Duration(step) * time.Millisecond)
+			n := int64(1 + i%3)
+			expected, err := memBackend.allow(ctx, key, n, now)
+			assert.Nil(t, err)
+			actual, err := redisBackend.allow(ctx, key, n, now)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, actual, "%s step %d", algorithm, step)
+		}
+	}
+}
+
+func TestLimiterNamespaces(t *testing.T) {
+	redisCache, err := caching.InitRedisCache(testRedisURI(t))
+	assert.Nil(t, err)
+	defer redisCache.Close()
+	for _, c := range []caching.Cache{caching.InitMemoryCache(time.Minute, time.Minute), redisCache} {
+		ctx := context.Background()
+		opts := &LimiterOptions{Limit: 1, Period: time.Minute, Prefix: "ratelimit_namespace"}
+		orders, err := NewLimiter(c.WithName("orders"), opts)
+		assert.Nil(t, err)
+		users, err := NewLimiter(c.WithName("users"), opts)
+		assert.Nil(t, err)
+		versioned, err := NewLimiter(c.WithName("orders").WithVersion(2), opts)
+		assert.Nil(t, err)
+		same, err := NewLimiter(c.WithName("orders"), opts)
+		assert.Nil(t, err)
+
+		for _, l := range []Limiter{orders, users, versioned} {
+			allowed, err := l.Allow(ctx, "tenant")
+			assert.Nil(t, err)
+			assert.True(t, allowed)
+		}
+		allowed, err := same.Allow(ctx, "tenant")
+		assert.Nil(t, err)
+		assert.False(t, allowed)
+	}
+	client, _ := caching.RedisClient(redisCache)
+	keys, err := client.Keys(context.Background(), "*ratelimit_namespace*").Result()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{
+		"orders:ratelimit_namespace:tenant",
+		"users:ratelimit_namespace:tenant",
+		"orders:@v2:ratelimit_namespace:tenant",
+	}, keys)
+}
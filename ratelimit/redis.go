@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// token_bucket_script mirrors takeTokens
+// KEYS[1]: bucket, ARGV: rate per ms, burst, now in ms, n, ttl in ms
+var token_bucket_script = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) * rate)
+	last = now
+end
+if tokens < n then
+	return {0, math.floor(tokens), math.ceil((n - tokens) / rate)}
+end
+tokens = tokens - n
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", last)
+redis.call("PEXPIRE", KEYS[1], ARGV[5])
+return {1, math.floor(tokens), 0}
+`)
+
+// sliding_window_script mirrors slideWindow
+// KEYS[1]: window, ARGV: period in ms, limit, now in ms, n, ttl in ms
+var sliding_window_script = redis.NewScript(`
+local period = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local window = math.floor(now / period)
+local state = redis.call("HMGET", KEYS[1], "window", "prev", "curr")
+local w = tonumber(state[1])
+local prev = tonumber(state[2]) or 0
+local curr = tonumber(state[3]) or 0
+if w == nil or w < window - 1 then
+	prev = 0
+	curr = 0
+elseif w == window - 1 then
+	prev = curr
+	curr = 0
+end
+local elapsed = (now - window * period) / period
+local estimate = prev * (1 - elapsed) + curr
+if estimate + n > limit then
+	local at
+	if curr + n <= limit then
+		at = window * period + math.ceil((1 - (limit - curr - n) / prev) * period)
+	else
+		at = (window + 1) * period + math.ceil((1 - (limit - n) / curr) * period)
+	end
+	local retry = math.max(1, math.floor(at) - now)
+	return {0, math.max(0, math.floor(limit - estimate)), retry}
+end
+curr = curr + n
+redis.call("HSET", KEYS[1], "window", window, "prev", prev, "curr", curr)
+redis.call("PEXPIRE", KEYS[1], ARGV[5])
+return {1, math.max(0, math.floor(limit - estimate - n)), 0}
+`)
+
+type redisBackend struct {
+	client redis.UniversalClient
+	// prefix is the namespace of the cache, the cache backend gets it from the cache api
+	prefix string
+	opts   LimiterOptions
+}
+
+func (b *redisBackend) allow(
+	ctx context.Context,
+	key string,
+	n int64,
+	now time.Time,
+) (Result, error) {
+	key = b.prefix + key
+	var cmd *redis.Cmd
+	switch b.opts.Algorithm {
+	case SLIDING_WINDOW_ALGORITHM:
+		cmd = sliding_window_script.Run(
+			ctx,
+			b.client,
+			[]string{key},
+			b.opts.Period.Milliseconds(),
+			b.opts.Limit,
+			now.UnixMilli(),
+			n,
+			windowTTL(b.opts).Milliseconds(),
+		)
+	default:
+		cmd = token_bucket_script.Run(
+			ctx,
+			b.client,
+			[]string{key},
+			float64(b.opts.Limit)/float64(b.opts.Period.Milliseconds()),
+			b.opts.Burst,
+			now.UnixMilli(),
+			n,
+			bucketTTL(b.opts).Milliseconds(),
+		)
+	}
+	res, err := cmd.Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  res[1],
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	tracer "github.com/BetaLixT/appInsightsTrace"
+	"github.com/karim-w/stdlib/circuitbreaker"
 	"go.uber.org/zap"
 )
 
@@ -29,6 +30,7 @@ type TracedClient interface {
 	WithTransport(transport http.Transport) TracedClient
 	WithStandardTransport() TracedClient
 	WithClientName(clientName string) TracedClient
+	WithCircuitBreaker(registry circuitbreaker.Registry) TracedClient
 	Close()
 }
 
@@ -60,6 +62,7 @@ type tracedhttpCLientImpl struct {
 	auth       AuthProvider
 	clientName string
 	transport  *http.Transport
+	breakers   circuitbreaker.Registry
 }
 
 // TracedClientProvider returns a new instance of the TracedClient
@@ -145,6 +148,19 @@ func (h *tracedhttpCLientImpl) WithClientName(clientName string) TracedClient {
 	return h
 }
 
+// WithCircuitBreaker guards the calls with the breaker of the client name, or of
+// the host when the client has no name, calls to an open circuit are not sent
+// and return a *circuitbreaker.ErrCircuitOpen
+// Params:
+//   - registry: The breakers of the remotes
+//
+// Returns:
+//   - TracedClient: The TracedClient instance
+func (h *tracedhttpCLientImpl) WithCircuitBreaker(registry circuitbreaker.Registry) TracedClient {
+	h.breakers = registry
+	return h
+}
+
 // Get() makes a GET HTTP request
 // Params:
 //   - ctx: context.Context => The context to be used
@@ -324,8 +340,17 @@ func (h *tracedhttpCLientImpl) doRequest(ctx context.Context, opt *ClientOptions
 	if ctx != nil {
 		req = req.WithContext(ctx)
 	}
+	var done func(outcome circuitbreaker.Outcome)
+	if h.breakers != nil {
+		if done, err = h.breakers.Get(remoteName).Allow(); err != nil {
+			return 0, err
+		}
+	}
 	now := time.Now()
 	resp, err := h.c.Do(req)
+	if done != nil {
+		done(circuitbreaker.HTTPOutcome(req, resp, err))
+	}
 	if err != nil {
 		code := 502
 		if resp != nil {
@@ -0,0 +1,80 @@
+package stdlib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/karim-w/stdlib/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTracedClientCircuitBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	registry, err := circuitbreaker.NewRegistry(&circuitbreaker.Options{FailureThreshold: 2})
+	assert.Nil(t, err)
+	client := TracedClientProviderWithName(nil, zap.NewNop(), "partner").
+		WithCircuitBreaker(registry)
+
+	for i := 0; i < 2; i++ {
+		code, err := client.Get(context.Background(), srv.URL, nil, nil)
+		assert.Equal(t, http.StatusBadGateway, code)
+		assert.NotNil(t, err)
+	}
+	code, err := client.Get(context.Background(), srv.URL, nil, nil)
+	var open *circuitbreaker.ErrCircuitOpen
+	assert.True(t, errors.As(err, &open))
+	assert.Equal(t, "partner", open.Name)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestTracedClientCancelledProbe(t *testing.T) {
+	var fail int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	registry, err := circuitbreaker.NewRegistry(&circuitbreaker.Options{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	client := TracedClientProviderWithName(nil, zap.NewNop(), "partner").
+		WithCircuitBreaker(registry)
+
+	client.Get(context.Background(), srv.URL, nil, nil)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, circuitbreaker.STATE_HALF_OPEN, registry.States()["partner"])
+
+	// a probe cancelled by the caller neither closes nor opens the circuit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Get(ctx, srv.URL+"/slow", nil, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, circuitbreaker.STATE_HALF_OPEN, registry.States()["partner"])
+
+	atomic.StoreInt32(&fail, 0)
+	code, err := client.Get(context.Background(), srv.URL, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, circuitbreaker.STATE_CLOSED, registry.States()["partner"])
+}